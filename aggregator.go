@@ -0,0 +1,137 @@
+package metering
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An aggregated meter event being built for a time bucket
+type aggregate struct {
+	msg *MeterMessage
+	end time.Time
+	// hash of the contributing unique ids, used to derive a deterministic UniqueId
+	ids hash.Hash
+}
+
+// Combines meter messages with the same MeterApiName, CustomerId and
+// Dimensions whose MeterTimeInMillis fall in the same time bucket.
+type aggregator struct {
+	bucket            time.Duration
+	aggregation       AggregationType
+	meterAggregations map[string]AggregationType
+
+	mutex      sync.Mutex
+	aggregates map[string]*aggregate
+}
+
+func newAggregator(m *Metering) *aggregator {
+	return &aggregator{
+		bucket:            m.AggregationBucket,
+		aggregation:       m.Aggregation,
+		meterAggregations: m.MeterAggregations,
+		aggregates:        make(map[string]*aggregate),
+	}
+}
+
+// Whether a message takes part in aggregation. Cancellations are sent as is.
+func (a *aggregator) accepts(msg *MeterMessage) bool {
+	return msg.Dimensions[CancelMeter] != "true"
+}
+
+// Combine the message into the aggregate of its bucket
+func (a *aggregator) add(msg *MeterMessage) {
+	bucketMillis := a.bucket.Milliseconds()
+	start := msg.MeterTimeInMillis - msg.MeterTimeInMillis%bucketMillis
+	key := aggregateKey(msg, start)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	agg, ok := a.aggregates[key]
+	if !ok {
+		dimensions := make(map[string]string, len(msg.Dimensions))
+		for k, v := range msg.Dimensions {
+			dimensions[k] = v
+		}
+		agg = &aggregate{
+			msg: &MeterMessage{
+				MeterApiName:      msg.MeterApiName,
+				CustomerId:        msg.CustomerId,
+				MeterValue:        msg.MeterValue,
+				MeterTimeInMillis: start,
+				Dimensions:        dimensions,
+			},
+			end: time.Unix(0, (start+bucketMillis)*int64(time.Millisecond)),
+			ids: sha1.New(),
+		}
+		agg.ids.Write([]byte(key))
+		a.aggregates[key] = agg
+	} else {
+		agg.msg.MeterValue = combine(a.aggregationOf(msg.MeterApiName), agg.msg.MeterValue, msg.MeterValue)
+	}
+	agg.ids.Write([]byte{0})
+	agg.ids.Write([]byte(msg.UniqueId))
+}
+
+// Take the aggregates of the buckets ended at now, or all of them when now is zero
+func (a *aggregator) take(now time.Time) []*MeterMessage {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var msgs []*MeterMessage
+	for key, agg := range a.aggregates {
+		if !now.IsZero() && now.Before(agg.end) {
+			continue
+		}
+		sum := agg.ids.Sum(nil)
+		agg.msg.UniqueId = fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+		msgs = append(msgs, agg.msg)
+		delete(a.aggregates, key)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].MeterTimeInMillis < msgs[j].MeterTimeInMillis })
+	return msgs
+}
+
+func (a *aggregator) aggregationOf(meterApiName string) AggregationType {
+	if aggregation, ok := a.meterAggregations[meterApiName]; ok {
+		return aggregation
+	}
+	return a.aggregation
+}
+
+func combine(aggregation AggregationType, current float64, value float64) float64 {
+	switch aggregation {
+	case Max:
+		if value > current {
+			return value
+		}
+		return current
+	case Min:
+		if value < current {
+			return value
+		}
+		return current
+	default:
+		return current + value
+	}
+}
+
+// Identity of the aggregate: meter, customer, sorted dimensions and bucket start
+func aggregateKey(msg *MeterMessage, start int64) string {
+	dimensions := make([]string, 0, len(msg.Dimensions))
+	for k, v := range msg.Dimensions {
+		dimensions = append(dimensions, k+"\x02"+v)
+	}
+	sort.Strings(dimensions)
+	return strings.Join([]string{
+		msg.MeterApiName,
+		msg.CustomerId,
+		strings.Join(dimensions, "\x00"),
+		fmt.Sprint(start),
+	}, "\x01")
+}
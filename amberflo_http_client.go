@@ -2,9 +2,13 @@ package metering
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type HttpParams struct {
@@ -12,12 +16,22 @@ type HttpParams struct {
 	Url        string
 	HttpMethod string
 	Payload    []byte
+	// Header holds request headers added to the defaults
+	Header http.Header
+	// Idempotent allows retrying a request whatever its method, for example a read-only POST query
+	Idempotent bool
 }
 
 type AmberfloHttpClient struct {
 	ApiKey string
 	Logger Logger
 	Client http.Client
+	Tracer Tracer
+	// RateLimiter, when set, is applied to every request before it is sent.
+	RateLimiter *RateLimiter
+	// RetryPolicy, when set, retries the failed requests using one of RetryMethods, GET by default.
+	RetryPolicy  RetryPolicy
+	RetryMethods []string
 }
 
 func NewAmberfloHttpClient(apiKey string, logger Logger, httpClient http.Client) *AmberfloHttpClient {
@@ -29,24 +43,100 @@ func NewAmberfloHttpClient(apiKey string, logger Logger, httpClient http.Client)
 	return client
 }
 
-// http client to make REST call
-func (client *AmberfloHttpClient) sendHttpRequest(apiName string, url string, httpMethod string, payload []byte) ([]byte, error) {
-	signature := fmt.Sprintf("sendHttpRequest(%s, %s, %s): ", apiName, httpMethod, url)
+// http client to make REST call, the request is abandoned when ctx is done
+func (client *AmberfloHttpClient) sendHttpRequestContext(ctx context.Context, apiName string, url string, httpMethod string, payload []byte) ([]byte, error) {
+	return client.send(ctx, &HttpParams{ApiName: apiName, Url: url, HttpMethod: httpMethod, Payload: payload})
+}
+
+// http client to make a read-only REST call, retried like a GET whatever its method
+func (client *AmberfloHttpClient) sendReadOnlyRequestContext(ctx context.Context, apiName string, url string, httpMethod string, payload []byte) ([]byte, error) {
+	return client.send(ctx, &HttpParams{ApiName: apiName, Url: url, HttpMethod: httpMethod, Payload: payload, Idempotent: true})
+}
+
+func (client *AmberfloHttpClient) send(ctx context.Context, params *HttpParams) ([]byte, error) {
+	if client.RetryPolicy == nil || !client.retries(params) {
+		return client.attempt(ctx, params)
+	}
+
+	for attempt := 1; ; attempt++ {
+		body, err := client.attempt(ctx, params)
+		//a fail-fast rate limiter asks not to wait
+		if err == nil || ctx.Err() != nil || errors.Is(err, ErrRateLimitExceeded) {
+			return body, err
+		}
+		statusCode, header := responseOf(err)
+		delay, retry := client.RetryPolicy.Retry(attempt, statusCode, header, err)
+		if !retry {
+			return body, err
+		}
+		client.logf("sendHttpRequest(%s, %s, %s): attempt %d error: %s, retrying in %s", params.ApiName, params.HttpMethod, params.Url, attempt, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return body, err
+		}
+	}
+}
+
+// Whether the request is retried, idempotent requests always are
+func (client *AmberfloHttpClient) retries(params *HttpParams) bool {
+	if params.Idempotent {
+		return true
+	}
+	if len(client.RetryMethods) == 0 {
+		return params.HttpMethod == http.MethodGet
+	}
+	for _, method := range client.RetryMethods {
+		if strings.EqualFold(method, params.HttpMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+// Send the request once, after the rate limiter and within the tracer
+func (client *AmberfloHttpClient) attempt(ctx context.Context, params *HttpParams) ([]byte, error) {
+	if client.RateLimiter != nil {
+		if err := client.RateLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("sendHttpRequest(%s, %s, %s): %w", params.ApiName, params.HttpMethod, params.Url, err)
+		}
+	}
+	if client.Tracer == nil {
+		body, _, err := client.do(ctx, params)
+		return body, err
+	}
+
+	ctx, hook := client.Tracer.StartRequest(ctx, params.ApiName, params.HttpMethod, params.Url)
+	start := time.Now()
+	body, status, err := client.do(ctx, params)
+	hook.EndRequest(status, time.Since(start), err)
+	return body, err
+}
+
+// Send the request, returns the response body and status code
+func (client *AmberfloHttpClient) do(ctx context.Context, params *HttpParams) ([]byte, int, error) {
+	httpMethod := params.HttpMethod
+	signature := fmt.Sprintf("sendHttpRequest(%s, %s, %s): ", params.ApiName, httpMethod, params.Url)
 
 	client.logf("%s sending http request", signature)
-	if httpMethod != "GET" {
-		client.logf("%s API Payload %s", signature, string(payload))
+	if httpMethod != "GET" && params.Header.Get("Content-Encoding") == "" {
+		client.logf("%s API Payload %s", signature, string(params.Payload))
 	}
-	req, err := http.NewRequest(httpMethod, url, bytes.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, httpMethod, params.Url, bytes.NewReader(params.Payload))
 	if err != nil {
-		return nil, fmt.Errorf("%s error creating request: %s", signature, err)
+		return nil, 0, fmt.Errorf("%s error creating request: %s", signature, err)
 	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("X-API-KEY", client.ApiKey)
+	for key, values := range params.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
 
 	res, err := client.Client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %s", err)
+		return nil, 0, fmt.Errorf("error sending request: %w", err)
 	}
 	//finally
 	defer res.Body.Close()
@@ -54,14 +144,23 @@ func (client *AmberfloHttpClient) sendHttpRequest(apiName string, url string, ht
 	body, err := ioutil.ReadAll(res.Body)
 	if res.StatusCode < 400 {
 		client.logf("%s API response: %s", signature, res.Status)
-		return body, nil
+		return body, res.StatusCode, nil
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %s", err)
+		return nil, res.StatusCode, fmt.Errorf("error reading response body: %s", err)
 	}
 
-	return nil, fmt.Errorf("response %s: %d – %s", res.Status, res.StatusCode, string(body))
+	return nil, res.StatusCode, &APIError{
+		ApiName:    params.ApiName,
+		Method:     httpMethod,
+		URL:        params.Url,
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header,
+		Body:       body,
+		RequestId:  requestIdOf(res.Header),
+	}
 }
 
 func (client *AmberfloHttpClient) logf(msg string, args ...interface{}) {
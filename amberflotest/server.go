@@ -0,0 +1,611 @@
+// Package amberflotest provides an in-memory fake of the Amberflo API for
+// integration tests, built on net/http/httptest.
+package amberflotest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amberflo/metering-go/v2"
+	"github.com/xtgo/uuid"
+)
+
+// Server is a fake Amberflo API keeping its state in memory. It serves the
+// endpoints called by the clients of the metering package.
+type Server struct {
+	*httptest.Server
+	// ApiKey, when set, is required in the X-API-KEY header of every request.
+	ApiKey string
+
+	mutex             sync.Mutex
+	meters            []*metering.MeterMessage
+	uniqueIds         map[string]bool
+	cancelled         map[string]bool
+	customers         map[string]*metering.Customer
+	pricingPlans      map[string]*metering.CustomerProductPlan
+	prepaidOrders     map[string]*metering.CustomerPrepaid
+	promotions        map[string]*metering.Promotion
+	appliedPromotions map[string]*metering.CustomerAppliedPromotion
+	invoices          map[string][]*metering.CustomerProductInvoice
+	notifications     map[string]*metering.Notification
+	unitPrices        map[string]float64
+}
+
+// Start a fake Amberflo API. Close it when the test is done.
+func NewServer() *Server {
+	s := &Server{
+		uniqueIds:         make(map[string]bool),
+		cancelled:         make(map[string]bool),
+		customers:         make(map[string]*metering.Customer),
+		pricingPlans:      make(map[string]*metering.CustomerProductPlan),
+		prepaidOrders:     make(map[string]*metering.CustomerPrepaid),
+		promotions:        make(map[string]*metering.Promotion),
+		appliedPromotions: make(map[string]*metering.CustomerAppliedPromotion),
+		invoices:          make(map[string][]*metering.CustomerProductInvoice),
+		notifications:     make(map[string]*metering.Notification),
+		unitPrices:        make(map[string]float64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ingest", s.handleIngest)
+	mux.HandleFunc("/usage", s.handleUsage)
+	mux.HandleFunc("/customers", s.handleCustomers)
+	mux.HandleFunc("/customers/", s.handleCustomers)
+	mux.HandleFunc("/customers/stage", s.handleCustomerStage)
+	mux.HandleFunc("/payments/cost/usage-cost", s.handleUsageCost)
+	mux.HandleFunc("/payments/pricing/amberflo/customer-pricing", s.handleCustomerPricing)
+	mux.HandleFunc("/payments/pricing/amberflo/customer-prepaid", s.handlePrepaid)
+	mux.HandleFunc("/payments/pricing/amberflo/customer-prepaid/list", s.handlePrepaidList)
+	mux.HandleFunc("/payments/external/prepaid-payment-status", s.handlePrepaidPaymentStatus)
+	mux.HandleFunc("/payments/pricing/amberflo/customer-promotions", s.handleCustomerPromotions)
+	mux.HandleFunc("/payments/pricing/amberflo/customer-promotions/list", s.handleCustomerPromotionsList)
+	mux.HandleFunc("/payments/pricing/amberflo/account-pricing/promotions", s.handlePromotion)
+	mux.HandleFunc("/payments/pricing/amberflo/account-pricing/promotions/list", s.handlePromotionsList)
+	mux.HandleFunc("/payments/billing/customer-product-invoice", s.handleInvoice)
+	mux.HandleFunc("/payments/billing/customer-product-invoice/all", s.handleInvoiceList)
+	mux.HandleFunc("/notification", s.handleNotification)
+	mux.HandleFunc("/notification/", s.handleNotification)
+
+	s.Server = httptest.NewServer(s.authenticate(mux))
+	return s
+}
+
+// Options pointing the REST clients at the server
+func (s *Server) ClientOptions() []metering.ClientOption {
+	return []metering.ClientOption{metering.WithRegion(s.Region())}
+}
+
+// Options pointing the metering client at the server
+func (s *Server) MeteringOptions() []metering.MeteringOption {
+	return []metering.MeteringOption{metering.WithMeteringRegion(s.Region())}
+}
+
+// Region serving both APIs from the server, for WithRegion and WithMeteringRegion
+func (s *Server) Region() metering.Region {
+	return metering.CustomRegion(s.URL, s.URL)
+}
+
+// Meters ingested so far, cancellations excluded
+func (s *Server) Meters() []*metering.MeterMessage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.activeMeters()
+}
+
+// Make a promotion available to ListPromotions, GetPromotionById and ApplyPromotion
+func (s *Server) AddPromotion(promotion *metering.Promotion) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if promotion.Id == "" {
+		promotion.Id = newId()
+	}
+	s.promotions[promotion.Id] = promotion
+}
+
+// Add invoices of a customer, the last one added is the latest invoice
+func (s *Server) AddInvoices(customerId string, invoices ...*metering.CustomerProductInvoice) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.invoices[customerId] = append(s.invoices[customerId], invoices...)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.ApiKey != "" && r.Header.Get("X-API-KEY") != s.ApiKey {
+			writeError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer reader.Close()
+		body = reader
+	}
+
+	var msgs []*metering.MeterMessage
+	if err := json.NewDecoder(body).Decode(&msgs); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, msg := range msgs {
+		if msg.MeterApiName == "" || msg.CustomerId == "" || msg.MeterTimeInMillis < 1 {
+			writeError(w, http.StatusBadRequest, "'meterApiName', 'customerId' and 'meterTimeInMillis' are required")
+			return
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, msg := range msgs {
+		switch {
+		case msg.Dimensions[metering.CancelMeter] == "true":
+			s.cancelled[msg.UniqueId] = true
+		case msg.UniqueId != "" && s.uniqueIds[msg.UniqueId]:
+			//duplicate of an ingested meter
+		default:
+			s.uniqueIds[msg.UniqueId] = true
+			s.meters = append(s.meters, msg)
+		}
+	}
+	writeJSON(w, map[string]string{"status": "success"})
+}
+
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var payload metering.UsagePayload
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	if payload.MeterApiName == "" || payload.TimeRange == nil {
+		writeError(w, http.StatusBadRequest, "'meterApiName' and 'timeRange' are required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, s.usage(&payload))
+}
+
+func (s *Server) handleUsageCost(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var key metering.UsageCostsKey
+	if !readJSON(w, r, &key) {
+		return
+	}
+	if key.TimeRange == nil {
+		writeError(w, http.StatusBadRequest, "'timeRange' is required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, s.usageCost(&key))
+}
+
+func (s *Server) handleCustomers(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		customer, ok := s.customers[r.URL.Query().Get("customerId")]
+		if !ok {
+			writeJSON(w, struct{}{})
+			return
+		}
+		writeJSON(w, customer)
+
+	case http.MethodPost, http.MethodPut:
+		var customer metering.Customer
+		if !readJSON(w, r, &customer) {
+			return
+		}
+		if customer.CustomerId == "" || customer.CustomerName == "" {
+			writeError(w, http.StatusBadRequest, "'customerId' and 'customerName' are required")
+			return
+		}
+		existing, exists := s.customers[customer.CustomerId]
+		now := time.Now().Unix()
+		if r.Method == http.MethodPost {
+			if exists {
+				writeError(w, http.StatusConflict, "customer already exists")
+				return
+			}
+			customer.CreateTime = now
+			if r.URL.Query().Get("autoCreateCustomerInStripe") == "true" {
+				if customer.Traits == nil {
+					customer.Traits = make(map[string]string)
+				}
+				customer.Traits[metering.StripeTraitKey] = "cus_" + strings.Replace(newId(), "-", "", -1)[:14]
+			}
+		} else {
+			if !exists {
+				writeError(w, http.StatusNotFound, "customer not found")
+				return
+			}
+			customer.CreateTime = existing.CreateTime
+		}
+		customer.UpdateTime = now
+		s.customers[customer.CustomerId] = &customer
+		writeJSON(w, &customer)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleCustomerStage(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPut) {
+		return
+	}
+	var request metering.UpdateLifecycleStageRequest
+	if !readJSON(w, r, &request) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	customer, ok := s.customers[request.CustomerId]
+	if !ok {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+	customer.LifecycleStage = request.LifecycleStage
+	customer.UpdateTime = time.Now().Unix()
+	writeJSON(w, customer)
+}
+
+func (s *Server) handleCustomerPricing(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var plan metering.CustomerProductPlan
+	if !readJSON(w, r, &plan) {
+		return
+	}
+	if plan.CustomerId == "" || plan.ProductPlanId == "" {
+		writeError(w, http.StatusBadRequest, "'customerId' and 'productPlanId' are required")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pricingPlans[plan.CustomerId] = &plan
+	writeJSON(w, &plan)
+}
+
+func (s *Server) handlePrepaid(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		var order metering.CustomerPrepaid
+		if !readJSON(w, r, &order) {
+			return
+		}
+		if order.CustomerId == "" {
+			writeError(w, http.StatusBadRequest, "'customerId' is required")
+			return
+		}
+		if order.Id == "" {
+			order.Id = newId()
+		}
+		now := time.Now().Unix()
+		order.CreateTimeInSeconds = now
+		order.ModifiedTimeInSeconds = now
+		order.OriginalWorth = order.PrepaidPrice
+		order.FirstInvoiceUri = fmt.Sprintf("prepaid/%s/%s", order.CustomerId, order.Id)
+		if order.ExternalPayment {
+			order.PaymentStatus = metering.PENDING
+		} else {
+			order.PaymentStatus = metering.NOT_NEEDED
+		}
+		s.prepaidOrders[order.Id] = &order
+		writeJSON(w, &order)
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		order, ok := s.prepaidOrders[query.Get("Id")]
+		if !ok || order.CustomerId != query.Get("CustomerId") {
+			writeError(w, http.StatusNotFound, "prepaid order not found")
+			return
+		}
+		delete(s.prepaidOrders, order.Id)
+		writeJSON(w, order)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handlePrepaidList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	customerId := r.URL.Query().Get("CustomerId")
+	orders := []*metering.CustomerPrepaid{}
+	for _, order := range s.prepaidOrders {
+		if order.CustomerId == customerId {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].StartTimeInSeconds < orders[j].StartTimeInSeconds })
+	writeJSON(w, orders)
+}
+
+func (s *Server) handlePrepaidPaymentStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	var status metering.ExternalPrepaidPaymentStatus
+	if !readJSON(w, r, &status) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, order := range s.prepaidOrders {
+		if order.FirstInvoiceUri == status.PrepaidUri {
+			order.PaymentStatus = status.PaymentStatus
+			order.PaymentId = status.PaymentId
+			order.PrepaidPaymentTimeInSeconds = status.PaymentTimeInSeconds
+			writeJSON(w, &status)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "prepaid order not found")
+}
+
+func (s *Server) handleCustomerPromotions(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		var request metering.ApplyPromotionRequest
+		if !readJSON(w, r, &request) {
+			return
+		}
+		promotion, ok := s.promotions[request.PromotionId]
+		if !ok {
+			writeError(w, http.StatusNotFound, "promotion not found")
+			return
+		}
+		applied := &metering.CustomerAppliedPromotion{
+			Id:                 newId(),
+			CustomerId:         request.CustomerId,
+			PromotionId:        promotion.Id,
+			ProductId:          request.ProductId,
+			AppliedTimeRange:   request.AppliedTimeRange,
+			AddedTimeInSeconds: time.Now().Unix(),
+			RelationId:         newId(),
+		}
+		s.appliedPromotions[applied.Id] = applied
+		writeJSON(w, applied)
+
+	case http.MethodDelete:
+		query := r.URL.Query()
+		applied, ok := s.appliedPromotions[query.Get("Id")]
+		if !ok || applied.CustomerId != query.Get("CustomerId") {
+			writeError(w, http.StatusNotFound, "applied promotion not found")
+			return
+		}
+		delete(s.appliedPromotions, applied.Id)
+		applied.RemovedTimeInSeconds = time.Now().Unix()
+		writeJSON(w, applied)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *Server) handleCustomerPromotionsList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	customerId := r.URL.Query().Get("CustomerId")
+	applied := []*metering.CustomerAppliedPromotion{}
+	for _, promotion := range s.appliedPromotions {
+		if promotion.CustomerId == customerId {
+			applied = append(applied, promotion)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool { return applied[i].AddedTimeInSeconds < applied[j].AddedTimeInSeconds })
+	writeJSON(w, applied)
+}
+
+func (s *Server) handlePromotion(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	promotion, ok := s.promotions[r.URL.Query().Get("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "promotion not found")
+		return
+	}
+	writeJSON(w, promotion)
+}
+
+func (s *Server) handlePromotionsList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	promotions := []*metering.Promotion{}
+	for _, promotion := range s.promotions {
+		promotions = append(promotions, promotion)
+	}
+	sort.Slice(promotions, func(i, j int) bool { return promotions[i].PromotionName < promotions[j].PromotionName })
+	writeJSON(w, promotions)
+}
+
+func (s *Server) handleInvoice(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	query := r.URL.Query()
+	invoices := s.invoices[query.Get("customerId")]
+
+	if query.Get("latest") == "true" {
+		if len(invoices) == 0 {
+			writeError(w, http.StatusNotFound, "invoice not found")
+			return
+		}
+		writeJSON(w, invoices[len(invoices)-1])
+		return
+	}
+
+	for _, invoice := range invoices {
+		key := invoice.InvoiceKey
+		if key.ProductPlanId == query.Get("productPlanId") &&
+			strconv.FormatInt(key.Year, 10) == query.Get("year") &&
+			strconv.FormatInt(key.Month, 10) == query.Get("month") &&
+			strconv.FormatInt(key.Day, 10) == query.Get("day") {
+			writeJSON(w, invoice)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "invoice not found")
+}
+
+func (s *Server) handleInvoiceList(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	invoices := s.invoices[r.URL.Query().Get("customerId")]
+	if invoices == nil {
+		invoices = []*metering.CustomerProductInvoice{}
+	}
+	writeJSON(w, invoices)
+}
+
+func (s *Server) handleNotification(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/notification"), "/")
+	switch {
+	case id == "" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		var notification metering.Notification
+		if !readJSON(w, r, &notification) {
+			return
+		}
+		now := time.Now().Unix()
+		if r.Method == http.MethodPost {
+			notification.Id = newId()
+			notification.CreateTime = now
+		} else {
+			existing, ok := s.notifications[notification.Id]
+			if !ok {
+				writeError(w, http.StatusNotFound, "notification not found")
+				return
+			}
+			notification.CreateTime = existing.CreateTime
+		}
+		notification.UpdateTime = now
+		s.notifications[notification.Id] = &notification
+		writeJSON(w, &notification)
+
+	case id != "" && (r.Method == http.MethodGet || r.Method == http.MethodDelete):
+		notification, ok := s.notifications[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "notification not found")
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.notifications, id)
+		}
+		writeJSON(w, notification)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// Ingested meters that were not cancelled, callers hold the mutex
+func (s *Server) activeMeters() []*metering.MeterMessage {
+	meters := make([]*metering.MeterMessage, 0, len(s.meters))
+	for _, msg := range s.meters {
+		if !s.cancelled[msg.UniqueId] {
+			meters = append(meters, msg)
+		}
+	}
+	return meters
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid JSON body: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func newId() string {
+	return uuid.NewRandom().String()
+}
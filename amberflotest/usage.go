@@ -0,0 +1,320 @@
+package amberflotest
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/amberflo/metering-go/v2"
+)
+
+// Set the price of one unit of a meter, used to compute usage costs
+func (s *Server) SetUnitPrice(meterApiName string, price float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.unitPrices[meterApiName] = price
+}
+
+// Values of a group in each interval of the time range
+type usageGroup struct {
+	info   map[string]string
+	values []float64
+	seen   []bool
+	total  float64
+}
+
+// Aggregate the ingested meters like the /usage endpoint, callers hold the mutex
+func (s *Server) usage(payload *metering.UsagePayload) *metering.DetailedMeterAggregation {
+	intervals := intervalsOf(payload.TimeRange, payload.TimeGroupingInterval)
+	groups := s.group(intervals, payload.TimeGroupingInterval, payload.GroupBy, payload.Filter,
+		func(msg *metering.MeterMessage) (float64, bool) {
+			return msg.MeterValue, msg.MeterApiName == payload.MeterApiName
+		},
+		aggregateFunc(payload.Aggregation))
+	groups = take(groups, payload.Take)
+
+	result := &metering.DetailedMeterAggregation{
+		SecondsSinceEpochIntervals: intervals,
+		Metadata: &metering.MeterAggregationMetadata{
+			MeterApiName:         payload.MeterApiName,
+			Aggregation:          payload.Aggregation,
+			TimeGroupingInterval: payload.TimeGroupingInterval,
+			GroupBy:              payload.GroupBy,
+			TimeRange:            payload.TimeRange,
+			Take:                 payload.Take,
+			Filter:               payload.Filter,
+		},
+	}
+	for _, g := range groups {
+		group := metering.DetailedMeterAggregationGroup{
+			GroupValue: g.total,
+			Group:      &metering.GroupInfo{GroupInfo: g.info},
+		}
+		for i, value := range g.values {
+			group.Values = append(group.Values, metering.DetailedAggregationValue{
+				PercentageFromPrevious: percentageFromPrevious(g.values, i),
+				Value:                  value,
+				SecondsSinceEpochUtc:   intervals[i],
+			})
+		}
+		result.ClientMeters = append(result.ClientMeters, group)
+	}
+	return result
+}
+
+// Price the ingested meters like the /payments/cost/usage-cost endpoint, callers hold the mutex
+func (s *Server) usageCost(key *metering.UsageCostsKey) *metering.UsageCosts {
+	intervals := intervalsOf(key.TimeRange, key.TimeGroupingInterval)
+	units := s.group(intervals, key.TimeGroupingInterval, key.GroupBy, key.Filters,
+		func(msg *metering.MeterMessage) (float64, bool) {
+			return msg.MeterValue, true
+		},
+		aggregateFunc(metering.Sum))
+	prices := s.group(intervals, key.TimeGroupingInterval, key.GroupBy, key.Filters,
+		func(msg *metering.MeterMessage) (float64, bool) {
+			return msg.MeterValue * s.unitPrices[msg.MeterApiName], true
+		},
+		aggregateFunc(metering.Sum))
+	prices = take(prices, key.Take)
+
+	result := &metering.UsageCosts{
+		Key:                        key,
+		SecondsSinceEpochIntervals: intervals,
+		PageInfo: &metering.PageInfo{
+			PageNumber:   1,
+			PageSize:     int64(len(prices)),
+			TotalPages:   1,
+			TotalResults: int64(len(prices)),
+		},
+	}
+	for _, p := range prices {
+		u := findGroup(units, p.info, len(intervals))
+		costs := metering.UsageGroupCosts{
+			GroupInfos:                       p.info,
+			MeteredUnits:                     u.total,
+			Price:                            p.total,
+			PriceBeforeDiscounts:             p.total,
+			PriceMinusPrepaid:                p.total,
+			PriceAfterPayAsYouGoPromotion:    p.total,
+			PriceAfterNonPayAsYouGoPromotion: p.total,
+		}
+		for i := range intervals {
+			costs.Costs = append(costs.Costs, metering.UsageGroupCostValue{
+				StartTimeInSeconds:       intervals[i],
+				MeteredUnits:             u.values[i],
+				Price:                    p.values[i],
+				PricePercentageDiff:      percentageFromPrevious(p.values, i),
+				MeterUnitsPercentageDiff: percentageFromPrevious(u.values, i),
+				PriceBeforeDiscounts:     p.values[i],
+			})
+		}
+		result.CostList = append(result.CostList, costs)
+	}
+	return result
+}
+
+// Group the active meters within the intervals by the given dimensions
+func (s *Server) group(intervals []int64, interval metering.AggregationInterval, groupBy []string,
+	filter map[string][]string, value func(*metering.MeterMessage) (float64, bool),
+	aggregate func(float64, float64) float64) []*usageGroup {
+
+	groups := make(map[string]*usageGroup)
+	var order []string
+	for _, msg := range s.activeMeters() {
+		v, ok := value(msg)
+		if !ok || !matches(msg, filter) {
+			continue
+		}
+		i := indexOf(intervals, intervalStart(msg.MeterTimeInMillis/1000, interval))
+		if i < 0 {
+			continue
+		}
+
+		info := make(map[string]string, len(groupBy))
+		keys := make([]string, 0, len(groupBy))
+		for _, dimension := range groupBy {
+			info[dimension] = dimensionOf(msg, dimension)
+			keys = append(keys, info[dimension])
+		}
+		key := strings.Join(keys, "\x00")
+
+		g, ok := groups[key]
+		if !ok {
+			g = &usageGroup{info: info, values: make([]float64, len(intervals)), seen: make([]bool, len(intervals))}
+			groups[key] = g
+			order = append(order, key)
+		}
+		if g.seen[i] {
+			g.values[i] = aggregate(g.values[i], v)
+		} else {
+			g.values[i] = v
+			g.seen[i] = true
+		}
+	}
+
+	result := make([]*usageGroup, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		first := true
+		for i, v := range g.values {
+			if !g.seen[i] {
+				continue
+			}
+			if first {
+				g.total = v
+				first = false
+			} else {
+				g.total = aggregate(g.total, v)
+			}
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+func aggregateFunc(aggregation metering.AggregationType) func(float64, float64) float64 {
+	switch aggregation {
+	case metering.Min:
+		return func(a, b float64) float64 {
+			if b < a {
+				return b
+			}
+			return a
+		}
+	case metering.Max:
+		return func(a, b float64) float64 {
+			if b > a {
+				return b
+			}
+			return a
+		}
+	default:
+		return func(a, b float64) float64 { return a + b }
+	}
+}
+
+// Keep the top groups by total value
+func take(groups []*usageGroup, t *metering.Take) []*usageGroup {
+	if t == nil {
+		return groups
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if t.IsAscending {
+			return groups[i].total < groups[j].total
+		}
+		return groups[i].total > groups[j].total
+	})
+	if t.Limit > 0 && int64(len(groups)) > t.Limit {
+		groups = groups[:t.Limit]
+	}
+	return groups
+}
+
+func findGroup(groups []*usageGroup, info map[string]string, intervals int) *usageGroup {
+	for _, g := range groups {
+		if sameInfo(g.info, info) {
+			return g
+		}
+	}
+	return &usageGroup{info: info, values: make([]float64, intervals), seen: make([]bool, intervals)}
+}
+
+func sameInfo(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func matches(msg *metering.MeterMessage, filter map[string][]string) bool {
+	for dimension, values := range filter {
+		if len(values) == 0 {
+			continue
+		}
+		found := false
+		for _, value := range values {
+			if dimensionOf(msg, dimension) == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// customerId is accepted as a dimension like the Amberflo API does
+func dimensionOf(msg *metering.MeterMessage, dimension string) string {
+	if dimension == "customerId" {
+		return msg.CustomerId
+	}
+	return msg.Dimensions[dimension]
+}
+
+// Start of every interval of the time range, in seconds since epoch
+func intervalsOf(timeRange *metering.TimeRange, interval metering.AggregationInterval) []int64 {
+	end := timeRange.EndTimeInSeconds
+	if end == 0 {
+		end = time.Now().Unix()
+	}
+
+	var intervals []int64
+	for start := intervalStart(timeRange.StartTimeInSeconds, interval); start < end; start = nextInterval(start, interval) {
+		intervals = append(intervals, start)
+	}
+	return intervals
+}
+
+func intervalStart(seconds int64, interval metering.AggregationInterval) int64 {
+	t := time.Unix(seconds, 0).UTC()
+	switch interval {
+	case metering.Hour:
+		t = t.Truncate(time.Hour)
+	case metering.Week:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		t = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case metering.Month:
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Unix()
+}
+
+func nextInterval(start int64, interval metering.AggregationInterval) int64 {
+	t := time.Unix(start, 0).UTC()
+	switch interval {
+	case metering.Hour:
+		t = t.Add(time.Hour)
+	case metering.Week:
+		t = t.AddDate(0, 0, 7)
+	case metering.Month:
+		t = t.AddDate(0, 1, 0)
+	default:
+		t = t.AddDate(0, 0, 1)
+	}
+	return t.Unix()
+}
+
+func indexOf(intervals []int64, start int64) int {
+	for i, interval := range intervals {
+		if interval == start {
+			return i
+		}
+	}
+	return -1
+}
+
+func percentageFromPrevious(values []float64, i int) float64 {
+	if i == 0 || values[i-1] == 0 {
+		return 0
+	}
+	return (values[i] - values[i-1]) / values[i-1] * 100
+}
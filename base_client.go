@@ -13,17 +13,53 @@ func WithCustomLogger(logger Logger) ClientOption {
 	}
 }
 
+func WithTracer(tracer Tracer) ClientOption {
+	return func(u *BaseClient) {
+		u.Tracer = tracer
+	}
+}
+
+// Apply limiter to every request, share it between clients to enforce a common limit.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(u *BaseClient) {
+		u.RateLimiter = limiter
+	}
+}
+
+// Retry the failed idempotent requests with policy, see WithRetryOnMethods.
+// Requests are not retried by default.
+func WithClientRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(u *BaseClient) {
+		u.RetryPolicy = policy
+	}
+}
+
+// Retry the requests using methods instead of only GET, for example
+// WithRetryOnMethods("GET", "PUT", "DELETE"). Requires WithClientRetryPolicy.
+func WithRetryOnMethods(methods ...string) ClientOption {
+	return func(u *BaseClient) {
+		u.RetryMethods = methods
+	}
+}
+
 type BaseClient struct {
 	ApiKey             string
+	BaseURL            string
 	Client             http.Client
 	Logger             Logger
+	Tracer             Tracer
+	RateLimiter        *RateLimiter
+	RetryPolicy        RetryPolicy
+	RetryMethods       []string
+	Middlewares        []Middleware
 	AmberfloHttpClient AmberfloHttpClient
 }
 
 func NewBaseClient(apiKey string, opts ...ClientOption) *BaseClient {
 	bc := &BaseClient{
-		ApiKey: apiKey,
-		Client: *http.DefaultClient,
+		ApiKey:  apiKey,
+		BaseURL: Endpoint,
+		Client:  *http.DefaultClient,
 	}
 
 	//iterate through each option
@@ -36,7 +72,11 @@ func NewBaseClient(apiKey string, opts ...ClientOption) *BaseClient {
 	}
 
 	bc.logf("instantiated the logger of type for BaseClient: %s", reflect.TypeOf(bc.Logger))
-	amberfloHttpClient := NewAmberfloHttpClient(apiKey, bc.Logger, bc.Client)
+	amberfloHttpClient := NewAmberfloHttpClient(apiKey, bc.Logger, withMiddlewares(bc.Client, bc.Middlewares))
+	amberfloHttpClient.Tracer = bc.Tracer
+	amberfloHttpClient.RateLimiter = bc.RateLimiter
+	amberfloHttpClient.RetryPolicy = bc.RetryPolicy
+	amberfloHttpClient.RetryMethods = bc.RetryMethods
 	bc.AmberfloHttpClient = *amberfloHttpClient
 
 	return bc
@@ -0,0 +1,67 @@
+package metering
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Queue the cancellation of a previously ingested meter. The fields must match the original meter.
+func (m *Metering) Cancel(uniqueId string, meterApiName string, customerId string, meterTimeInMillis int64) error {
+	return m.CancelAll([]*MeterMessage{{
+		UniqueId:          uniqueId,
+		MeterApiName:      meterApiName,
+		CustomerId:        customerId,
+		MeterTimeInMillis: meterTimeInMillis,
+	}})
+}
+
+// Queue the cancellation of previously ingested meters. All messages are validated
+// before any cancellation is queued, and their Dimensions maps are left untouched.
+func (m *Metering) CancelAll(msgs []*MeterMessage) error {
+	cancellations := make([]*MeterMessage, 0, len(msgs))
+	for i, msg := range msgs {
+		cancellation, err := cancellationOf(msg)
+		if err != nil {
+			return fmt.Errorf("cancellation %d: %w", i, err)
+		}
+		cancellations = append(cancellations, cancellation)
+	}
+
+	for _, cancellation := range cancellations {
+		if err := m.Meter(cancellation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build the cancellation event of an ingested meter
+func cancellationOf(msg *MeterMessage) (*MeterMessage, error) {
+	if msg == nil {
+		return nil, invalidRequest("meter message is required")
+	}
+	if strings.Trim(msg.UniqueId, " ") == "" {
+		return nil, invalidRequest("'UniqueId' of the ingested meter is required")
+	}
+	if msg.MeterApiName == "" || msg.CustomerId == "" {
+		return nil, invalidRequest("'MeterApiName' and 'CustomerId' are required fields")
+	}
+	if msg.MeterTimeInMillis < 1 {
+		return nil, invalidRequest("invalid UtcTimeMillis: should be milliseconds in UTC")
+	}
+
+	dimensions := make(map[string]string, len(msg.Dimensions)+1)
+	for k, v := range msg.Dimensions {
+		dimensions[k] = v
+	}
+	dimensions[CancelMeter] = "true"
+
+	return &MeterMessage{
+		UniqueId:          msg.UniqueId,
+		MeterApiName:      msg.MeterApiName,
+		CustomerId:        msg.CustomerId,
+		MeterValue:        msg.MeterValue,
+		MeterTimeInMillis: msg.MeterTimeInMillis,
+		Dimensions:        dimensions,
+	}, nil
+}
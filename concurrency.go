@@ -0,0 +1,141 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMinConcurrency = 1
+	DefaultMaxConcurrency = 1000
+)
+
+const (
+	//multiplicative decrease on throttling and server errors
+	overloadBackoff = 0.5
+	//gentler decrease when the API slows down
+	latencyBackoff = 0.9
+	//latency above this multiple of the baseline counts as a slowdown
+	latencyTolerance = 2
+	//weight of an observation pulling the baseline latency up
+	baselineDrift = 0.01
+)
+
+// Additive increase, multiplicative decrease limit of the concurrent calls to
+// the ingest API. The limit grows by one per window of successful calls and is
+// cut when the API throttles, fails or slows down.
+type concurrencyLimiter struct {
+	floor   float64
+	ceiling float64
+	now     func() time.Time
+
+	mutex sync.Mutex
+	limit float64
+	// lowest recent latency of a successful call
+	baseline     time.Duration
+	lastDecrease time.Time
+}
+
+func newConcurrencyLimiter(m *Metering) *concurrencyLimiter {
+	floor := m.MinConcurrency
+	if floor < 1 {
+		floor = DefaultMinConcurrency
+	}
+	ceiling := m.MaxConcurrency
+	if ceiling < 1 {
+		ceiling = DefaultMaxConcurrency
+	}
+	if ceiling < floor {
+		ceiling = floor
+	}
+	return &concurrencyLimiter{
+		floor:   float64(floor),
+		ceiling: float64(ceiling),
+		now:     m.now,
+		//start at the ceiling and back off once the API pushes back
+		limit: float64(ceiling),
+	}
+}
+
+// Current number of concurrent calls allowed
+func (l *concurrencyLimiter) current() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return int(l.limit)
+}
+
+// Adjust the limit to the outcome of a call, reports whether the limit increased
+func (l *concurrencyLimiter) observe(latency time.Duration, statusCode int, err error) bool {
+	overloaded := err != nil && (statusCode == 429 || statusCode >= 500 || (statusCode == 0 && transportFailure(err)))
+	if err != nil && !overloaded {
+		//a rejected or cancelled request, or a failure of the client itself, says nothing about the load of the API
+		return false
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	slow := false
+	if err == nil {
+		switch {
+		case l.baseline == 0 || latency < l.baseline:
+			l.baseline = latency
+		default:
+			slow = latency > l.baseline*latencyTolerance
+			l.baseline += time.Duration(float64(latency-l.baseline) * baselineDrift)
+		}
+	}
+
+	if overloaded || slow {
+		now := l.now()
+		//calls started before the last decrease report the load it already reacted to
+		if now.Sub(l.lastDecrease) < latency {
+			return false
+		}
+		backoff := latencyBackoff
+		if overloaded {
+			backoff = overloadBackoff
+		}
+		l.limit *= backoff
+		if l.limit < l.floor {
+			l.limit = l.floor
+		}
+		l.lastDecrease = now
+		return false
+	}
+
+	before := int(l.limit)
+	l.limit += 1 / l.limit
+	if l.limit > l.ceiling {
+		l.limit = l.ceiling
+	}
+	return int(l.limit) > before
+}
+
+// Network failures such as timeouts and refused connections. Errors raised on the client
+// side, like a cancelled call, a fail-fast RateLimiter or a FileSink error, are not.
+func transportFailure(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Current limit of the concurrent calls to the ingest API
+func (m *Metering) ConcurrencyLimit() int {
+	return m.limiter.current()
+}
+
+// Adapt the concurrency limit to the outcome of an ingest call and wake up the
+// senders waiting for a slot when it grows
+func (m *Metering) adapt(latency time.Duration, statusCode int, err error) {
+	if m.limiter.observe(latency, statusCode, err) {
+		m.mutex.Lock()
+		m.upcond.Broadcast()
+		m.mutex.Unlock()
+	}
+}
@@ -1,8 +1,8 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 )
 
@@ -52,16 +52,24 @@ func NewCustomerClient(apiKey string, opts ...ClientOption) *CustomerClient {
 }
 
 func (m *CustomerClient) AddorUpdateCustomer(customer *Customer, createInStripe bool) (*Customer, error) {
+	return m.AddorUpdateCustomerContext(context.Background(), customer, createInStripe)
+}
+
+func (m *CustomerClient) AddorUpdateCustomerContext(ctx context.Context, customer *Customer, createInStripe bool) (*Customer, error) {
 	if customer.CustomerId == "" || customer.CustomerName == "" {
-		return nil, errors.New("customer info 'CustomerId' and 'CustomerName' are required fields")
+		return nil, invalidRequest("customer info 'CustomerId' and 'CustomerName' are required fields")
 	}
 
-	return m.sendCustomerToApi(customer, createInStripe)
+	return m.sendCustomerToApi(ctx, customer, createInStripe)
 }
 
 func (c *CustomerClient) UpdateLifecycleStage(request *UpdateLifecycleStageRequest) (*Customer, error) {
+	return c.UpdateLifecycleStageContext(context.Background(), request)
+}
+
+func (c *CustomerClient) UpdateLifecycleStageContext(ctx context.Context, request *UpdateLifecycleStageRequest) (*Customer, error) {
 	if request.CustomerId == "" || request.LifecycleStage == "" {
-		return nil, errors.New("'CustomerId' and 'LifecycleStage' are required fields")
+		return nil, invalidRequest("'CustomerId' and 'LifecycleStage' are required fields")
 	}
 
 	signature := fmt.Sprintf("updateLifecycleStage(%v)", request)
@@ -71,11 +79,11 @@ func (c *CustomerClient) UpdateLifecycleStage(request *UpdateLifecycleStageReque
 		return nil, fmt.Errorf("%s error marshalling payload: %s", signature, err)
 	}
 
-	url := fmt.Sprintf("%s/customers/stage", Endpoint)
+	url := fmt.Sprintf("%s/customers/stage", c.BaseURL)
 	httpMethod := "PUT"
-	b, err = c.AmberfloHttpClient.sendHttpRequest("Customers/Stage", url, httpMethod, b)
+	b, err = c.AmberfloHttpClient.sendHttpRequestContext(ctx, "Customers/Stage", url, httpMethod, b)
 	if err != nil {
-		return nil, fmt.Errorf("%s error making %s http call: %s", signature, httpMethod, err)
+		return nil, fmt.Errorf("%s error making %s http call: %w", signature, httpMethod, err)
 	}
 
 	customer := &Customer{}
@@ -88,12 +96,16 @@ func (c *CustomerClient) UpdateLifecycleStage(request *UpdateLifecycleStageReque
 }
 
 func (c *CustomerClient) GetCustomer(customerId string) (*Customer, error) {
+	return c.GetCustomerContext(context.Background(), customerId)
+}
+
+func (c *CustomerClient) GetCustomerContext(ctx context.Context, customerId string) (*Customer, error) {
 	signature := fmt.Sprintf("GetCustomer(%s)", customerId)
 	var customer *Customer
-	urlGet := fmt.Sprintf("%s/customers/?customerId=%s", Endpoint, customerId)
-	data, err := c.AmberfloHttpClient.sendHttpRequest("Customers", urlGet, "GET", nil)
+	urlGet := fmt.Sprintf("%s/customers/?customerId=%s", c.BaseURL, customerId)
+	data, err := c.AmberfloHttpClient.sendHttpRequestContext(ctx, "Customers", urlGet, "GET", nil)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %s", err)
+		return nil, fmt.Errorf("error sending request: %w", err)
 	}
 	if data != nil && string(data) != "{}" {
 		err = json.Unmarshal(data, &customer)
@@ -105,28 +117,28 @@ func (c *CustomerClient) GetCustomer(customerId string) (*Customer, error) {
 	return customer, nil
 }
 
-func (c *CustomerClient) sendCustomerToApi(payload *Customer, createInStripe bool) (*Customer, error) {
+func (c *CustomerClient) sendCustomerToApi(ctx context.Context, payload *Customer, createInStripe bool) (*Customer, error) {
 	signature := fmt.Sprintf("sendCustomerToApi(%v)", payload)
 
 	c.logf("Checking if customer deatils exist %s", payload.CustomerId)
-	customer, _ := c.GetCustomer(payload.CustomerId)
+	customer, _ := c.GetCustomerContext(ctx, payload.CustomerId)
 
 	b, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("%s error marshalling payload: %s", signature, err)
 	}
 
-	url := fmt.Sprintf("%s/customers", Endpoint)
+	url := fmt.Sprintf("%s/customers", c.BaseURL)
 	httpMethod := ""
 	if customer != nil && customer.CustomerId == payload.CustomerId {
 		httpMethod = "PUT"
 	} else {
 		httpMethod = "POST"
-		url = fmt.Sprintf("%s/customers?autoCreateCustomerInStripe=%t", Endpoint, createInStripe)
+		url = fmt.Sprintf("%s/customers?autoCreateCustomerInStripe=%t", c.BaseURL, createInStripe)
 	}
-	b, err = c.AmberfloHttpClient.sendHttpRequest("customers", url, httpMethod, b)
+	b, err = c.AmberfloHttpClient.sendHttpRequestContext(ctx, "customers", url, httpMethod, b)
 	if err != nil {
-		return nil, fmt.Errorf("%s error making %s http call: %s", signature, httpMethod, err)
+		return nil, fmt.Errorf("%s error making %s http call: %w", signature, httpMethod, err)
 	}
 
 	if b != nil {
@@ -1,8 +1,8 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 )
 
@@ -26,9 +26,13 @@ func NewCustomerPricingPlanClient(apiKey string, opts ...ClientOption) *Customer
 }
 
 func (cpc *CustomerPricingPlanClient) AddOrUpdate(payload *CustomerProductPlan) (*CustomerProductPlan, error) {
+	return cpc.AddOrUpdateContext(context.Background(), payload)
+}
+
+func (cpc *CustomerPricingPlanClient) AddOrUpdateContext(ctx context.Context, payload *CustomerProductPlan) (*CustomerProductPlan, error) {
 	signature := fmt.Sprintf("AddOrUpdate(%v)", payload)
 	if payload.CustomerId == "" || payload.ProductPlanId == "" {
-		return nil, errors.New("'CustomerId' and 'ProductPlanId' are required fields")
+		return nil, invalidRequest("'CustomerId' and 'ProductPlanId' are required fields")
 	}
 
 	if payload.ProductId == "" {
@@ -40,13 +44,13 @@ func (cpc *CustomerPricingPlanClient) AddOrUpdate(payload *CustomerProductPlan)
 		return nil, fmt.Errorf("%s error marshalling payload: %s", signature, err)
 	}
 
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-pricing", Endpoint)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-pricing", cpc.BaseURL)
 	apiName := "Customer Pricing"
 	cpc.logf("Customer pricing client payload %s", string(b))
-	body, err := cpc.AmberfloHttpClient.sendHttpRequest(apiName, url, "POST", b)
+	body, err := cpc.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "POST", b)
 	if err != nil {
 		cpc.logf("API error: %s", err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	v := string(body)
@@ -0,0 +1,204 @@
+package metering
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// A batch that could not be delivered to the ingest API
+type DeadLetter struct {
+	Batch          []*MeterMessage `json:"batch"`
+	Error          string          `json:"error"`
+	Attempts       int             `json:"attempts"`
+	FailedAtMillis int64           `json:"failedAtMillis"`
+}
+
+// DeadLetterSink stores the batches that exhausted their retries so they can
+// be replayed with Metering.ReplayDeadLetters once the outage is over.
+type DeadLetterSink interface {
+	// Put stores a failed batch.
+	Put(letter *DeadLetter) error
+	// Drain returns the stored batches. They stay in the sink until ack is
+	// called, once they were delivered or stored again.
+	Drain() (letters []*DeadLetter, ack func() error, err error)
+}
+
+// Dead-letter sink appending every failed batch as a JSON line to a file
+type FileDeadLetterSink struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+func NewFileDeadLetterSink(path string) *FileDeadLetterSink {
+	return &FileDeadLetterSink{Path: path}
+}
+
+func (s *FileDeadLetterSink) Put(letter *DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return fmt.Errorf("error marshalling dead letter: %s", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening dead letter file: %s", err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(line); err != nil {
+		return fmt.Errorf("error writing dead letter file: %s", err)
+	}
+	return file.Sync()
+}
+
+func (s *FileDeadLetterSink) Drain() ([]*DeadLetter, func() error, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return nil, func() error { return nil }, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening dead letter file: %s", err)
+	}
+	defer file.Close()
+
+	var letters []*DeadLetter
+	var offset int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("error reading dead letter file: %s", err)
+		}
+		offset += int64(len(line))
+		if len(bytes.TrimSpace(line)) > 0 {
+			//a corrupt line, partially written when the process stopped, is skipped and dropped on ack
+			var letter DeadLetter
+			if jsonErr := json.Unmarshal(line, &letter); jsonErr == nil {
+				letters = append(letters, &letter)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return letters, func() error { return s.truncate(offset) }, nil
+}
+
+// Remove the first offset bytes of the file, keeping the letters put since they were drained
+func (s *FileDeadLetterSink) truncate(offset int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return fmt.Errorf("error opening dead letter file: %s", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading dead letter file: %s", err)
+	}
+	rest, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("error reading dead letter file: %s", err)
+	}
+	if len(rest) == 0 {
+		if err := os.Remove(s.Path); err != nil {
+			return fmt.Errorf("error removing dead letter file: %s", err)
+		}
+		return nil
+	}
+
+	//replace the file atomically so a crash keeps either version
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, rest, 0o644); err != nil {
+		return fmt.Errorf("error writing dead letter file: %s", err)
+	}
+	if err := os.Rename(tmp, s.Path); err != nil {
+		return fmt.Errorf("error replacing dead letter file: %s", err)
+	}
+	return nil
+}
+
+// Re-submit the batches stored in the dead-letter sink and wait for them.
+// Batches failing again are stored back in sink. The replayed batches are
+// removed from sink only once all of them were delivered or stored again.
+func (m *Metering) ReplayDeadLetters(sink DeadLetterSink) error {
+	if !m.IsRunning() {
+		return ErrClosed
+	}
+
+	letters, ack, err := sink.Drain()
+	if err != nil {
+		return fmt.Errorf("error draining dead letters: %s", err)
+	}
+
+	m.logf("replaying %d dead letters", len(letters))
+	batches := make([]*batch, 0, len(letters))
+	for _, letter := range letters {
+		msgs := make([]interface{}, 0, len(letter.Batch))
+		for _, msg := range letter.Batch {
+			msgs = append(msgs, msg)
+		}
+		b := &batch{msgs: msgs, deadLetters: sink, done: make(chan struct{})}
+		//waiting for a concurrency slot must not hold up shutdown
+		if !m.track(b) {
+			break
+		}
+		m.dispatch(b)
+		batches = append(batches, b)
+	}
+
+	lost := 0
+	for _, b := range batches {
+		<-b.done
+		if !b.kept {
+			lost++
+		}
+	}
+	if len(batches) < len(letters) {
+		return fmt.Errorf("%w, %d dead letters were not replayed and are kept in the sink", ErrClosed, len(letters)-len(batches))
+	}
+	if lost > 0 {
+		return fmt.Errorf("%d dead letters were neither delivered nor stored again, kept in the sink", lost)
+	}
+	if err := ack(); err != nil {
+		return fmt.Errorf("error removing replayed dead letters: %s", err)
+	}
+	return nil
+}
+
+// Store a batch that failed for good in the dead-letter sink
+func (m *Metering) deadLetter(b *batch, attempts int, err error) bool {
+	sink := m.DeadLetterSink
+	if b.deadLetters != nil {
+		sink = b.deadLetters
+	}
+	if sink == nil {
+		return false
+	}
+	letter := &DeadLetter{
+		Batch:          meterMessages(b.msgs),
+		Error:          err.Error(),
+		Attempts:       attempts,
+		FailedAtMillis: m.now().UnixNano() / int64(time.Millisecond),
+	}
+	if putErr := sink.Put(letter); putErr != nil {
+		m.logf("error storing dead letter: %s", putErr)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package metering
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const DefaultDeduplicationMaxEntries = 100000
+
+// A unique id and the time it was first seen
+type dedupEntry struct {
+	id   string
+	seen time.Time
+}
+
+// Bounded window of the unique ids seen recently. Ids expire after ttl and the
+// oldest ids are evicted once maxEntries is reached.
+type dedupWindow struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	// entries ordered from the most to the least recently seen
+	order *list.List
+}
+
+func newDedupWindow(m *Metering) *dedupWindow {
+	maxEntries := m.DeduplicationMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultDeduplicationMaxEntries
+	}
+	return &dedupWindow{
+		ttl:        m.DeduplicationWindow,
+		maxEntries: maxEntries,
+		now:        m.now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Record the id and report whether it was already seen within the window
+func (d *dedupWindow) seen(id string) bool {
+	now := d.now()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	//expire the ids older than the window
+	for oldest := d.order.Back(); oldest != nil; oldest = d.order.Back() {
+		entry := oldest.Value.(*dedupEntry)
+		if now.Sub(entry.seen) < d.ttl {
+			break
+		}
+		d.order.Remove(oldest)
+		delete(d.entries, entry.id)
+	}
+
+	if _, ok := d.entries[id]; ok {
+		return true
+	}
+
+	d.entries[id] = d.order.PushFront(&dedupEntry{id: id, seen: now})
+	if d.order.Len() > d.maxEntries {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupEntry).id)
+	}
+	return false
+}
+
+// Remove the id recorded by seen for a message that was not accepted, so it can be sent again
+func (d *dedupWindow) forget(id string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if element, ok := d.entries[id]; ok {
+		d.order.Remove(element)
+		delete(d.entries, id)
+	}
+}
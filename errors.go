@@ -0,0 +1,79 @@
+package metering
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinels matched by errors.Is against the errors returned by the clients
+var (
+	// ErrNotFound matches a 404 response.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized matches a 401 or 403 response, usually an invalid API key.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrRateLimited matches a 429 response.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrValidation matches a 400 or 422 response and the requests rejected before being sent.
+	ErrValidation = errors.New("validation failed")
+)
+
+// Error returned when the Amberflo API responds with an error status
+type APIError struct {
+	ApiName    string
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Body       []byte
+	// RequestId identifies the request in the Amberflo logs, empty when the response has none.
+	RequestId string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s(%s %s): response %s: %d – %s", e.ApiName, e.Method, e.URL, e.Status, e.StatusCode, string(e.Body))
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// Headers carrying the id of a request, by order of preference
+var requestIdHeaders = []string{"X-Request-Id", "X-Amzn-Requestid", "X-Amz-Apigw-Id"}
+
+func requestIdOf(header http.Header) string {
+	for _, key := range requestIdHeaders {
+		if id := header.Get(key); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// Error of a request rejected by a client before it was sent
+type invalidRequestError struct {
+	msg string
+}
+
+func invalidRequest(msg string) error {
+	return &invalidRequestError{msg: msg}
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.msg
+}
+
+func (e *invalidRequestError) Is(target error) bool {
+	return target == ErrValidation
+}
@@ -1,6 +1,7 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -138,12 +139,16 @@ func NewInvoiceClient(apiKey string, opts ...ClientOption) *InvoiceClient {
 }
 
 func (ic *InvoiceClient) GetLatestInvoice(getCustomerInvoiceRequest *GetCustomerInvoiceRequest) (*CustomerProductInvoice, error) {
+	return ic.GetLatestInvoiceContext(context.Background(), getCustomerInvoiceRequest)
+}
+
+func (ic *InvoiceClient) GetLatestInvoiceContext(ctx context.Context, getCustomerInvoiceRequest *GetCustomerInvoiceRequest) (*CustomerProductInvoice, error) {
 	signature := fmt.Sprintf("GetLatestInvoice(%s): ", getCustomerInvoiceRequest.CustomerId)
 	if getCustomerInvoiceRequest.ProductId == "" {
 		getCustomerInvoiceRequest.ProductId = "1"
 	}
 	if getCustomerInvoiceRequest.CustomerId == "" {
-		return nil, errors.New("'CustomerId' is a required field")
+		return nil, invalidRequest("'CustomerId' is a required field")
 	}
 
 	queryParams, err := ic.getQueryParams(getCustomerInvoiceRequest)
@@ -152,7 +157,7 @@ func (ic *InvoiceClient) GetLatestInvoice(getCustomerInvoiceRequest *GetCustomer
 	}
 	queryParams = "latest=true&" + queryParams
 
-	body, err := ic.sendGetRequest("", queryParams, signature)
+	body, err := ic.sendGetRequest(ctx, "", queryParams, signature)
 	if err != nil {
 		return nil, err
 	}
@@ -167,6 +172,10 @@ func (ic *InvoiceClient) GetLatestInvoice(getCustomerInvoiceRequest *GetCustomer
 }
 
 func (ic *InvoiceClient) GetInvoice(getCustomerInvoiceByDateRequest *GetCustomerInvoiceByDateRequest) (*CustomerProductInvoice, error) {
+	return ic.GetInvoiceContext(context.Background(), getCustomerInvoiceByDateRequest)
+}
+
+func (ic *InvoiceClient) GetInvoiceContext(ctx context.Context, getCustomerInvoiceByDateRequest *GetCustomerInvoiceByDateRequest) (*CustomerProductInvoice, error) {
 	signature := fmt.Sprintf("GetInvoice(%s): ", getCustomerInvoiceByDateRequest.CustomerId)
 	if getCustomerInvoiceByDateRequest.ProductId == "" {
 		getCustomerInvoiceByDateRequest.ProductId = "1"
@@ -176,7 +185,7 @@ func (ic *InvoiceClient) GetInvoice(getCustomerInvoiceByDateRequest *GetCustomer
 		getCustomerInvoiceByDateRequest.Year <= 0 ||
 		getCustomerInvoiceByDateRequest.Month <= 0 ||
 		getCustomerInvoiceByDateRequest.Day <= 0 {
-		return nil, errors.New("'ProductPlanId', 'Year', 'Month' and 'Day' are required fields")
+		return nil, invalidRequest("'ProductPlanId', 'Year', 'Month' and 'Day' are required fields")
 	}
 
 	queryParams, err := ic.getQueryParams(getCustomerInvoiceByDateRequest)
@@ -184,7 +193,7 @@ func (ic *InvoiceClient) GetInvoice(getCustomerInvoiceByDateRequest *GetCustomer
 		return nil, err
 	}
 
-	body, err := ic.sendGetRequest("", queryParams, signature)
+	body, err := ic.sendGetRequest(ctx, "", queryParams, signature)
 	if err != nil {
 		return nil, err
 	}
@@ -199,12 +208,16 @@ func (ic *InvoiceClient) GetInvoice(getCustomerInvoiceByDateRequest *GetCustomer
 }
 
 func (ic *InvoiceClient) ListInvoice(getCustomerInvoiceRequest *GetCustomerInvoiceRequest) (*[]CustomerProductInvoice, error) {
+	return ic.ListInvoiceContext(context.Background(), getCustomerInvoiceRequest)
+}
+
+func (ic *InvoiceClient) ListInvoiceContext(ctx context.Context, getCustomerInvoiceRequest *GetCustomerInvoiceRequest) (*[]CustomerProductInvoice, error) {
 	signature := fmt.Sprintf("ListInvoice(%s): ", getCustomerInvoiceRequest.CustomerId)
 	if getCustomerInvoiceRequest.ProductId == "" {
 		getCustomerInvoiceRequest.ProductId = "1"
 	}
 	if getCustomerInvoiceRequest.CustomerId == "" {
-		return nil, errors.New("'CustomerId' is a required field")
+		return nil, invalidRequest("'CustomerId' is a required field")
 	}
 
 	queryParams, err := ic.getQueryParams(getCustomerInvoiceRequest)
@@ -212,7 +225,7 @@ func (ic *InvoiceClient) ListInvoice(getCustomerInvoiceRequest *GetCustomerInvoi
 		return nil, err
 	}
 
-	body, err := ic.sendGetRequest("/all", queryParams, signature)
+	body, err := ic.sendGetRequest(ctx, "/all", queryParams, signature)
 	if err != nil {
 		return nil, err
 	}
@@ -226,14 +239,14 @@ func (ic *InvoiceClient) ListInvoice(getCustomerInvoiceRequest *GetCustomerInvoi
 	return customerProductInvoice, nil
 }
 
-func (ic *InvoiceClient) sendGetRequest(path string, queryParams string, signature string) ([]byte, error) {
+func (ic *InvoiceClient) sendGetRequest(ctx context.Context, path string, queryParams string, signature string) ([]byte, error) {
 	apiName := "Invoice"
-	url := fmt.Sprintf("%s/payments/billing/customer-product-invoice%s?%s", Endpoint, path, queryParams)
+	url := fmt.Sprintf("%s/payments/billing/customer-product-invoice%s?%s", ic.BaseURL, path, queryParams)
 	ic.logf("%s calling API %s", signature, url)
-	body, err := ic.AmberfloHttpClient.sendHttpRequest(apiName, url, "GET", nil)
+	body, err := ic.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "GET", nil)
 	if err != nil {
 		ic.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 	return body, err
 }
@@ -1,10 +1,13 @@
 package metering
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"encoding/json"
 	"errors"
@@ -48,6 +51,56 @@ type MeterMessage struct {
 	Message
 }
 
+// OverflowPolicy decides what Meter does when the queue is full.
+type OverflowPolicy int
+
+const (
+	// Block waits until the queue has room, or the context of MeterContext is done.
+	Block OverflowPolicy = iota
+	// DropNewest discards the message being queued.
+	DropNewest
+	// DropOldest discards the oldest queued message to make room.
+	DropOldest
+	// ReturnError rejects the message with ErrQueueFull.
+	ReturnError
+)
+
+// Compression applied to the ingest request body
+type Compression string
+
+const (
+	NoCompression Compression = ""
+	Gzip          Compression = "gzip"
+)
+
+// Number of failed batches kept for the next Flush, the oldest are dropped first
+const maxUnreportedBatches = 1000
+
+// ErrQueueFull is returned by Meter when the queue is full and the overflow policy is ReturnError.
+var ErrQueueFull = errors.New("metering queue is full")
+
+// ErrClosed is returned by Meter once Shutdown has started.
+var ErrClosed = errors.New("metering client is closed")
+
+// Callback is notified of the outcome of every batch sent to the ingest API.
+// It is called from the goroutine that sent the batch, so implementations
+// must be safe for concurrent use and should not block.
+type Callback interface {
+	// Success is called once the batch has been accepted by the API.
+	Success(batch []*MeterMessage)
+	// Failure is called once the batch could not be delivered, after all retries.
+	Failure(batch []*MeterMessage, err error)
+}
+
+// MeteringClient is the interface of Metering used by code that queues meters.
+// Depend on it to substitute the meteringtest.Recorder in unit tests.
+type MeteringClient interface {
+	Meter(msg *MeterMessage) error
+	Shutdown() error
+}
+
+var _ MeteringClient = (*Metering)(nil)
+
 type MeteringOption func(*Metering)
 
 func WithDebug(debug bool) MeteringOption {
@@ -74,34 +127,303 @@ func WithLogger(logger Logger) MeteringOption {
 	}
 }
 
+func WithMeteringTracer(tracer Tracer) MeteringOption {
+	return func(m *Metering) {
+		m.Tracer = tracer
+	}
+}
+
+// Flush a batch before its serialized size exceeds maxBatchBytes. Zero disables the limit.
+func WithMaxBatchBytes(maxBatchBytes int) MeteringOption {
+	return func(m *Metering) {
+		m.MaxBatchBytes = maxBatchBytes
+	}
+}
+
+// Compress the body of ingest requests, for example with Gzip.
+func WithCompression(compression Compression) MeteringOption {
+	return func(m *Metering) {
+		m.Compression = compression
+	}
+}
+
+// Pre-aggregate messages with the same MeterApiName, CustomerId and Dimensions
+// whose MeterTimeInMillis fall in the same bucket of the given width. Each
+// bucket is sent as a single event once it has ended, with a deterministic UniqueId.
+func WithAggregation(bucket time.Duration, aggregation AggregationType) MeteringOption {
+	return func(m *Metering) {
+		m.AggregationBucket = bucket
+		m.Aggregation = aggregation
+	}
+}
+
+// Aggregate the messages of one meter with a different AggregationType than the default of WithAggregation.
+func WithMeterAggregation(meterApiName string, aggregation AggregationType) MeteringOption {
+	return func(m *Metering) {
+		if m.MeterAggregations == nil {
+			m.MeterAggregations = make(map[string]AggregationType)
+		}
+		m.MeterAggregations[meterApiName] = aggregation
+	}
+}
+
+// Drop messages whose UniqueId was already metered within window. At most
+// maxEntries ids are remembered, zero uses DefaultDeduplicationMaxEntries.
+func WithDeduplication(window time.Duration, maxEntries int) MeteringOption {
+	return func(m *Metering) {
+		m.DeduplicationWindow = window
+		m.DeduplicationMaxEntries = maxEntries
+	}
+}
+
+// Validate every message against the schema registry. In strict mode Meter
+// rejects non-conforming messages with a *ValidationError, otherwise the
+// violation is logged and the message is queued.
+func WithSchemaRegistry(registry *SchemaRegistry, strict bool) MeteringOption {
+	return func(m *Metering) {
+		m.SchemaRegistry = registry
+		m.StrictSchema = strict
+	}
+}
+
+// Number of messages the queue holds before the overflow policy applies. Default is BatchSize.
+func WithQueueCapacity(capacity int) MeteringOption {
+	return func(m *Metering) {
+		m.QueueCapacity = capacity
+	}
+}
+
+// What Meter does when the queue is full. Default is Block.
+func WithOverflowPolicy(policy OverflowPolicy) MeteringOption {
+	return func(m *Metering) {
+		m.OverflowPolicy = policy
+	}
+}
+
+// Register a hook called with every message dropped by the overflow policy.
+func WithDropHook(hook func(msg *MeterMessage)) MeteringOption {
+	return func(m *Metering) {
+		m.DropHook = hook
+	}
+}
+
+// Register a callback notified of the outcome of every batch.
+func WithCallback(callback Callback) MeteringOption {
+	return func(m *Metering) {
+		m.Callback = callback
+	}
+}
+
+// Send the batches to sink instead of the ingest API, see NewFanOutSink to do both.
+func WithSink(sink Sink) MeteringOption {
+	return func(m *Metering) {
+		m.Sink = sink
+	}
+}
+
+// Write the batches to sinks as well as to the default HttpSink, or to the sink set with WithSink.
+// The HttpSink keeps the endpoint, compression, HTTP client and other settings of the metering client.
+func WithAdditionalSinks(sinks ...Sink) MeteringOption {
+	return func(m *Metering) {
+		m.AdditionalSinks = append(m.AdditionalSinks, sinks...)
+	}
+}
+
+// Apply limiter to the ingest API calls, or to the writes to the sink set with WithSink.
+// Share it with the REST clients to enforce a common limit.
+func WithMeteringRateLimiter(limiter *RateLimiter) MeteringOption {
+	return func(m *Metering) {
+		m.RateLimiter = limiter
+	}
+}
+
+// Bound the adaptive limit of concurrent calls to the ingest API, defaults are
+// DefaultMinConcurrency and DefaultMaxConcurrency.
+func WithConcurrencyLimits(floor int, ceiling int) MeteringOption {
+	return func(m *Metering) {
+		m.MinConcurrency = floor
+		m.MaxConcurrency = ceiling
+	}
+}
+
+// Decide which failed ingest calls are retried and when. Default is NewDefaultRetryPolicy().
+func WithRetryPolicy(policy RetryPolicy) MeteringOption {
+	return func(m *Metering) {
+		m.RetryPolicy = policy
+	}
+}
+
+// Store the batches that exhausted their retries in sink.
+func WithDeadLetterSink(sink DeadLetterSink) MeteringOption {
+	return func(m *Metering) {
+		m.DeadLetterSink = sink
+	}
+}
+
+// Spool every batch to append-only segment files in dir before sending it, and
+// replay the batches left over by a previous process on start.
+func WithSpoolDir(dir string) MeteringOption {
+	return func(m *Metering) {
+		m.SpoolDir = dir
+	}
+}
+
+// Maximum size of a spool segment file before a new one is started.
+func WithSpoolSegmentBytes(segmentBytes int64) MeteringOption {
+	return func(m *Metering) {
+		m.SpoolSegmentBytes = segmentBytes
+	}
+}
+
+// Discard the oldest spool segments once the spool exceeds maxBytes or a
+// segment is older than maxAge. Zero disables the limit.
+func WithSpoolRetention(maxBytes int64, maxAge time.Duration) MeteringOption {
+	return func(m *Metering) {
+		m.SpoolMaxBytes = maxBytes
+		m.SpoolMaxAge = maxAge
+	}
+}
+
 // Amberflo.io metering client batches messages and flushes periodically at IntervalSeconds or
 // when the BatchSize limit is exceeded.
 type Metering struct {
+	// counters updated atomically, kept first for 64-bit alignment
+	enqueued       uint64
+	sent           uint64
+	failed         uint64
+	retried        uint64
+	dropped        uint64
+	duplicates     uint64
+	lastErrorNanos int64
+	// closed is set to 1 once shutdown has started
+	closed int32
+
 	Endpoint string
 	// IntervalSeconds is the frequency at which messages are flushed.
 	IntervalSeconds    time.Duration
 	BatchSize          int
+	MaxBatchBytes      int
+	Compression        Compression
 	Logger             Logger
+	Tracer             Tracer
+	RateLimiter        *RateLimiter
 	Debug              bool
 	Client             http.Client
+	Middlewares        []Middleware
 	ApiKey             string
 	AmberfloHttpClient AmberfloHttpClient
+	// Sink receives the batches, an HttpSink posting to Endpoint by default.
+	Sink Sink
+	// AdditionalSinks receive the batches as well, through a FanOutSink.
+	AdditionalSinks []Sink
+	Callback        Callback
+	DeadLetterSink  DeadLetterSink
+	RetryPolicy     RetryPolicy
+
+	// MinConcurrency and MaxConcurrency bound the adaptive limit of concurrent calls to the ingest API.
+	MinConcurrency int
+	MaxConcurrency int
+
+	// QueueCapacity and OverflowPolicy control the backpressure applied by Meter.
+	QueueCapacity  int
+	OverflowPolicy OverflowPolicy
+	DropHook       func(msg *MeterMessage)
+
+	// AggregationBucket enables client-side pre-aggregation when set.
+	AggregationBucket time.Duration
+	Aggregation       AggregationType
+	MeterAggregations map[string]AggregationType
+
+	SchemaRegistry *SchemaRegistry
+	StrictSchema   bool
+
+	// DeduplicationWindow enables dropping repeated UniqueIds when set.
+	DeduplicationWindow     time.Duration
+	DeduplicationMaxEntries int
+
+	// SpoolDir enables the durable on-disk spool of batches when set.
+	SpoolDir          string
+	SpoolSegmentBytes int64
+	SpoolMaxBytes     int64
+	SpoolMaxAge       time.Duration
 
 	// channels
 	msgs     chan interface{}
+	flush    chan chan []*batch
 	quit     chan struct{}
 	shutdown chan struct{}
 
+	// cancelled to abandon the sink writes and retries in flight
+	abortCtx context.Context
+	abort    context.CancelFunc
+
 	// helper functions
 	uid func() string
 	now func() time.Time
 
+	// lifecycle is held for reading while queuing and for writing while closing the channels
+	lifecycle sync.RWMutex
+	// closing is closed once shutdown has started, releasing the blocked producers
+	closing     chan struct{}
+	stopped     chan struct{}
+	shutdownErr error
+
 	// Synch primitives to control number of concurrent calls to API
-	once    sync.Once
-	wg      sync.WaitGroup
-	mutex   sync.Mutex
-	upcond  sync.Cond
-	counter int
+	once      sync.Once
+	abortOnce sync.Once
+	mutex     sync.Mutex
+	upcond    sync.Cond
+	counter   int
+	aborted   bool
+	limiter   *concurrencyLimiter
+
+	// batches handed to sendAsync and not yet completed, guarded by mutex
+	batches map[*batch]struct{}
+	// batches that failed since the last Flush, guarded by mutex
+	unreported []*batch
+
+	// client-side pre-aggregation and deduplication
+	aggregator *aggregator
+	dedup      *dedupWindow
+
+	// on-disk spool and the batches left over by a previous process
+	spool     *spool
+	leftovers []*spoolBatch
+}
+
+// A batch of messages handed to the send pipeline. done is closed once the
+// batch has been delivered or has failed for good.
+type batch struct {
+	msgs    []interface{}
+	spooled *spoolEntry
+	// deadLetters overrides the DeadLetterSink for the batches replayed from it.
+	deadLetters DeadLetterSink
+	done        chan struct{}
+	err         error
+	// kept is set once the batch has been delivered or stored as a dead letter.
+	kept bool
+}
+
+// DeliveryError is returned by the context-aware calls when the context
+// expires before all queued messages reached the ingest API, and by Flush
+// when batches failed for good.
+type DeliveryError struct {
+	// Err is the context error that interrupted the call, or the error of
+	// the first failed batch when the call was not interrupted.
+	Err error
+	// Undelivered lists the messages handed to the send pipeline that were
+	// not acknowledged by the API when the call returned.
+	Undelivered []*MeterMessage
+	// Failures lists the errors of the batches that failed for good.
+	Failures []error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%d meter messages not delivered: %s", len(e.Undelivered), e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
 }
 
 // Create a new instance with a custom logger
@@ -113,12 +435,18 @@ func NewMeteringClient(apiKey string, opts ...MeteringOption) *Metering {
 		Debug:           false,
 		Client:          *http.DefaultClient,
 		ApiKey:          apiKey,
-		msgs:            make(chan interface{}, BatchSize),
+		QueueCapacity:   BatchSize,
+		RetryPolicy:     NewDefaultRetryPolicy(),
+		flush:           make(chan chan []*batch),
 		quit:            make(chan struct{}),
 		shutdown:        make(chan struct{}),
+		closing:         make(chan struct{}),
+		stopped:         make(chan struct{}),
+		batches:         make(map[*batch]struct{}),
 		now:             time.Now,
 		uid:             uid,
 	}
+	m.abortCtx, m.abort = context.WithCancel(context.Background())
 
 	//iterate through each option
 	for _, opt := range opts {
@@ -129,30 +457,113 @@ func NewMeteringClient(apiKey string, opts ...MeteringOption) *Metering {
 		m.Logger = NewAmberfloDefaultLogger()
 		m.log("instantiated the default logger")
 	}
+	if m.QueueCapacity < 1 {
+		m.QueueCapacity = 1
+	}
+	m.msgs = make(chan interface{}, m.QueueCapacity)
+	if m.AggregationBucket >= time.Millisecond {
+		m.aggregator = newAggregator(m)
+	}
+	if m.DeduplicationWindow > 0 {
+		m.dedup = newDedupWindow(m)
+	}
+	m.limiter = newConcurrencyLimiter(m)
 
-	amberfloHttpClient := NewAmberfloHttpClient(apiKey, m.Logger, m.Client)
+	amberfloHttpClient := NewAmberfloHttpClient(apiKey, m.Logger, withMiddlewares(m.Client, m.Middlewares))
+	amberfloHttpClient.Tracer = m.Tracer
+	//the rate limiter is applied by send, before the latency of the call is measured
 	m.AmberfloHttpClient = *amberfloHttpClient
+	if m.Sink == nil {
+		m.Sink = newHttpSink(m)
+	}
+	if len(m.AdditionalSinks) > 0 {
+		m.Sink = NewFanOutSink(append([]Sink{m.Sink}, m.AdditionalSinks...)...)
+	}
 
 	m.log("instantiating amberflo.io metering client")
 	m.upcond.L = &m.mutex
+
+	if m.SpoolDir != "" {
+		spool, leftovers, err := openSpool(m)
+		if err != nil {
+			m.logf("spool disabled: %s", err)
+		} else {
+			m.spool = spool
+			m.leftovers = leftovers
+		}
+		if len(m.leftovers) > 0 {
+			//replay the spooled batches without waiting for the first message
+			m.logf("replaying %d spooled batches", len(m.leftovers))
+			m.once.Do(m.startLoop)
+		}
+	}
 	return m
 }
 
 // Queue a metering message to send to Ingest API. Messages are flushes periodically at IntervalSeconds or when the BatchSize limit is exceeded.
 func (m *Metering) Meter(msg *MeterMessage) error {
+	return m.MeterContext(context.Background(), msg)
+}
+
+// MeterContext queues a metering message like Meter. With the Block overflow
+// policy it gives up and returns ctx.Err() if the queue stays full until the
+// context is done.
+func (m *Metering) MeterContext(ctx context.Context, msg *MeterMessage) error {
 	if msg.MeterApiName == "" {
-		return errors.New("'MeterName' is required field")
+		return invalidRequest("'MeterName' is required field")
 	}
 	if msg.MeterTimeInMillis < 1 {
-		return errors.New("invalid UtcTimeMillis: should be milliseconds in UTC")
+		return invalidRequest("invalid UtcTimeMillis: should be milliseconds in UTC")
+	}
+	if m.SchemaRegistry != nil {
+		if err := m.SchemaRegistry.Validate(msg); err != nil {
+			if m.StrictSchema {
+				return err
+			}
+			m.logf("meter message does not conform to schema: %s", err)
+		}
+	}
+
+	if !m.IsRunning() {
+		return ErrClosed
+	}
+	//the channels stay open until the message is queued or shutdown releases it
+	m.lifecycle.RLock()
+	defer m.lifecycle.RUnlock()
+	if !m.IsRunning() {
+		return ErrClosed
 	}
 
+	recorded := false
 	if strings.Trim(msg.UniqueId, " ") == "" {
 		msg.UniqueId = m.uid()
+	} else if m.dedup != nil && msg.Dimensions[CancelMeter] != "true" {
+		if m.dedup.seen(msg.UniqueId) {
+			atomic.AddUint64(&m.duplicates, 1)
+			m.debugf("dropping duplicate meter message: %+v", msg)
+			return nil
+		}
+		recorded = true
+	}
+	if m.aggregator != nil && m.aggregator.accepts(msg) {
+		m.once.Do(m.startLoop)
+		m.debugf("Aggregating meter message: %+v", msg)
+		m.aggregator.add(msg)
+		atomic.AddUint64(&m.enqueued, 1)
+		return nil
 	}
 	m.logf("Queuing meter message: %+v", msg)
-	m.queue(msg)
-	return nil
+	accepted, err := m.queue(ctx, msg)
+	if !accepted && recorded {
+		//a retry of a message that was not queued must not be dropped as a duplicate
+		m.dedup.forget(msg.UniqueId)
+	}
+	return err
+}
+
+// Reports whether the client accepts messages, false once Shutdown has started
+func (m *Metering) IsRunning() bool {
+	return atomic.LoadInt32(&m.closed) == 0
 }
 
 // Start goroutine for concurrent execution to monitor channels
@@ -160,115 +571,440 @@ func (m *Metering) startLoop() {
 	go m.loop()
 }
 
-// Queue the metering message
-func (m *Metering) queue(msg message) {
+// Queue the metering message, reports whether it was accepted or dropped by the overflow policy
+func (m *Metering) queue(ctx context.Context, msg message) (bool, error) {
 	m.once.Do(m.startLoop)
 	msg.setMessageId(m.uid())
 	msg.setTimestamp(timestamp(m.now()))
 	//send message to channel
-	m.msgs <- msg
+	if m.OverflowPolicy == Block {
+		select {
+		case m.msgs <- msg:
+			atomic.AddUint64(&m.enqueued, 1)
+			return true, nil
+		case <-m.closing:
+			return false, ErrClosed
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	for {
+		select {
+		case m.msgs <- msg:
+			atomic.AddUint64(&m.enqueued, 1)
+			return true, nil
+		default:
+		}
+
+		//the queue is full
+		switch m.OverflowPolicy {
+		case ReturnError:
+			return false, ErrQueueFull
+		case DropOldest:
+			select {
+			case oldest := <-m.msgs:
+				m.drop(oldest)
+			default:
+			}
+		default:
+			m.drop(msg)
+			return false, nil
+		}
+	}
+}
+
+// Count a message dropped by the overflow policy and report it to the hook
+func (m *Metering) drop(msg interface{}) {
+	atomic.AddUint64(&m.dropped, 1)
+	meterMessage, ok := msg.(*MeterMessage)
+	if !ok {
+		return
+	}
+	m.debugf("queue full, dropping %v", meterMessage)
+	//the message is lost, a retry with the same id must not be dropped as a duplicate
+	if m.dedup != nil && meterMessage.Dimensions[CancelMeter] != "true" {
+		m.dedup.forget(meterMessage.UniqueId)
+	}
+	if m.DropHook != nil {
+		m.DropHook(meterMessage)
+	}
+}
+
+// Number of messages dropped by the overflow policy
+func (m *Metering) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Number of messages dropped because their UniqueId was seen within the deduplication window
+func (m *Metering) DuplicatesDropped() uint64 {
+	return atomic.LoadUint64(&m.duplicates)
+}
+
+// Send all buffered messages and wait for the batches in flight, without shutting
+// down the client. Returns a *DeliveryError aggregating the failures of those batches.
+func (m *Metering) Flush() error {
+	return m.FlushContext(context.Background())
+}
+
+// FlushContext sends all buffered messages and waits until every batch in
+// flight has been delivered or has failed, like Flush. If the context expires
+// first, a *DeliveryError wrapping ctx.Err() lists the messages still pending.
+func (m *Metering) FlushContext(ctx context.Context) error {
+	m.once.Do(m.startLoop)
+	reply := make(chan []*batch, 1)
+	var pending []*batch
+	select {
+	case m.flush <- reply:
+		select {
+		case pending = <-reply:
+		case <-ctx.Done():
+			return m.undelivered(ctx.Err(), m.pendingBatches())
+		}
+	case <-m.shutdown:
+		//the listener loop has already handed over every message
+		pending = m.pendingBatches()
+	case <-ctx.Done():
+		return m.undelivered(ctx.Err(), m.pendingBatches())
+	}
+
+	if err := m.wait(ctx, pending); err != nil {
+		return err
+	}
+	return m.failures()
 }
 
-// Flush all messages in the queue, stop the timer, close all channels, shutdown the client
+// Flush all messages in the queue, stop the timer, close all channels, shutdown the client.
+// Shutdown is idempotent, later and concurrent calls wait for the first one and return its result.
 func (m *Metering) Shutdown() error {
+	return m.ShutdownContext(context.Background())
+}
+
+// ShutdownContext flushes the queue and shuts down the client like Shutdown.
+// If the context expires first, pending retries are abandoned and a
+// *DeliveryError wrapping ctx.Err() lists the messages that were not delivered.
+func (m *Metering) ShutdownContext(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+		//another call is shutting down the client
+		select {
+		case <-m.stopped:
+			return m.shutdownErr
+		case <-ctx.Done():
+			return m.undelivered(ctx.Err(), m.pendingBatches())
+		}
+	}
 	m.log("Running shutdown....")
+	//release the producers blocked on a full queue before waiting for them
+	close(m.closing)
+	m.lifecycle.Lock()
 	m.once.Do(m.startLoop)
-	//start shutdown by sending message to quit channel
-	m.quit <- struct{}{}
+	//start shutdown by closing the quit channel
+	close(m.quit)
 	//close the ingest meter messages channel
 	close(m.msgs)
-	//receive shutdown message, blocking call
-	<-m.shutdown
+	m.lifecycle.Unlock()
+
+	m.shutdownErr = m.stop(ctx)
+	close(m.stopped)
+	return m.shutdownErr
+}
+
+// Wait for the listener loop and the batches in flight, then close the spool
+func (m *Metering) stop(ctx context.Context) error {
+	//wait for the listener loop to hand over the remaining messages
+	select {
+	case <-m.shutdown:
+	case <-ctx.Done():
+		m.stopRetries()
+		<-m.shutdown
+		m.closeSpool()
+		return m.undelivered(ctx.Err(), m.pendingBatches())
+	}
+	//wait for all messages to be sent to the API
+	if err := m.wait(ctx, m.pendingBatches()); err != nil {
+		m.stopRetries()
+		m.closeSpool()
+		m.logf("Shutdown interrupted: %s", err)
+		return err
+	}
+	m.closeSpool()
 	m.log("Shutdown completed")
 	return nil
 }
 
+// Close the spool, undelivered batches stay on disk for the next start
+func (m *Metering) closeSpool() {
+	if m.spool != nil {
+		m.spool.close()
+	}
+}
+
+// Wait for the batches to complete or the context to expire
+func (m *Metering) wait(ctx context.Context, pending []*batch) error {
+	for _, b := range pending {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return m.undelivered(ctx.Err(), pending)
+		}
+	}
+	return nil
+}
+
+// Abandon the retries of batches in flight
+func (m *Metering) stopRetries() {
+	m.abortOnce.Do(func() {
+		m.mutex.Lock()
+		m.aborted = true
+		m.abort()
+		m.upcond.Broadcast()
+		m.mutex.Unlock()
+	})
+}
+
+// Snapshot of the batches in flight
+func (m *Metering) pendingBatches() []*batch {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pending := make([]*batch, 0, len(m.batches))
+	for b := range m.batches {
+		pending = append(pending, b)
+	}
+	return pending
+}
+
+// Build the error reporting the messages of the batches that have not completed
+func (m *Metering) undelivered(err error, pending []*batch) error {
+	var msgs []*MeterMessage
+	var failures []error
+	for _, b := range pending {
+		select {
+		case <-b.done:
+			if b.err == nil {
+				continue
+			}
+			failures = append(failures, b.err)
+		default:
+		}
+		msgs = append(msgs, meterMessages(b.msgs)...)
+	}
+	return &DeliveryError{Err: err, Undelivered: msgs, Failures: failures}
+}
+
+// Build the error reporting the batches that failed since the last call, nil when all were delivered
+func (m *Metering) failures() error {
+	m.mutex.Lock()
+	failed := m.unreported
+	m.unreported = nil
+	m.mutex.Unlock()
+
+	var msgs []*MeterMessage
+	var failures []error
+	for _, b := range failed {
+		msgs = append(msgs, meterMessages(b.msgs)...)
+		failures = append(failures, b.err)
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return &DeliveryError{Err: failures[0], Undelivered: msgs, Failures: failures}
+}
+
 // Sends batch to API asynchonrously and limits the number of concurrrent calls to API
-func (m *Metering) sendAsync(msgs []interface{}) {
+func (m *Metering) sendAsync(msgs []interface{}) *batch {
+	return m.submit(&batch{msgs: msgs, done: make(chan struct{})})
+}
+
+// Persist the batch in the spool and dispatch it
+func (m *Metering) submit(b *batch) *batch {
+	m.persist(b)
+	m.dispatch(b)
+	return b
+}
+
+// Write the batch to the spool
+func (m *Metering) persist(b *batch) {
+	if m.spool == nil {
+		return
+	}
+	entry, err := m.spool.write(meterMessages(b.msgs))
+	if err != nil {
+		m.logf("spool: batch not persisted: %s", err)
+	}
+	b.spooled = entry
+}
+
+// Persist and register the batch unless shutdown has started, so that shutdown waits for it
+func (m *Metering) track(b *batch) bool {
+	m.lifecycle.RLock()
+	defer m.lifecycle.RUnlock()
+	if !m.IsRunning() {
+		return false
+	}
+	m.persist(b)
 	m.mutex.Lock()
+	m.batches[b] = struct{}{}
+	m.mutex.Unlock()
+	return true
+}
 
-	//support 1000 asyncrhonus calls
-	for m.counter == 1000 {
+// Replay the batches spooled by a previous process
+func (m *Metering) replaySpool() {
+	for _, leftover := range m.leftovers {
+		msgs := make([]interface{}, 0, len(leftover.messages))
+		for _, msg := range leftover.messages {
+			msgs = append(msgs, msg)
+		}
+		m.dispatch(&batch{msgs: msgs, spooled: leftover.entry, done: make(chan struct{})})
+	}
+	m.leftovers = nil
+}
+
+// Start the goroutine sending the batch once a concurrency slot is free
+func (m *Metering) dispatch(b *batch) {
+	m.mutex.Lock()
+	m.batches[b] = struct{}{}
+
+	//wait for a slot within the adaptive concurrency limit
+	for m.counter >= m.limiter.current() && !m.aborted {
 		//sleep until signal
 		m.upcond.Wait()
 	}
 	m.counter++
 	m.mutex.Unlock()
-	m.wg.Add(1)
 
 	//spin new thread to call API with retry
 	go func() {
-		err := m.send(msgs)
-		if err != nil {
+		attempts, err := m.send(b.msgs)
+		acked := err == nil
+		kept := acked
+		if err == nil {
+			atomic.AddUint64(&m.sent, uint64(len(b.msgs)))
+		} else {
+			atomic.AddUint64(&m.failed, uint64(len(b.msgs)))
 			m.log(err.Error())
+			//a batch kept in the dead-letter sink no longer needs the spool
+			acked = m.deadLetter(b, attempts, err)
+			kept = acked
+			//a batch rejected by the API would be rejected again on every restart
+			if statusCode, _ := responseOf(err); !acked && rejected(statusCode) {
+				m.logf("dropping %d rejected meters from the spool", len(b.msgs))
+				acked = true
+			}
 		}
+		if acked && b.spooled != nil {
+			m.spool.ack(b.spooled)
+		}
+		m.notify(b.msgs, err)
 		m.mutex.Lock()
 		m.counter--
+		b.err = err
+		b.kept = kept
+		delete(m.batches, b)
+		if err != nil {
+			//keep the most recent failures for the next Flush
+			if len(m.unreported) == maxUnreportedBatches {
+				m.unreported = m.unreported[1:]
+			}
+			m.unreported = append(m.unreported, b)
+		}
+		close(b.done)
 		//signal the waiting blocked wait
 		m.upcond.Signal()
 		m.mutex.Unlock()
-		m.wg.Done()
 	}()
 }
 
-// Send the batch request with retry
-func (m *Metering) send(msgs []interface{}) error {
-	if len(msgs) == 0 {
-		return nil
+// Report the outcome of a batch to the registered callback
+func (m *Metering) notify(msgs []interface{}, err error) {
+	if m.Callback == nil || len(msgs) == 0 {
+		return
 	}
-
-	//serialize to json
-	b, err := json.Marshal(msgs)
 	if err != nil {
-		return fmt.Errorf("error marshalling msgs: %s", err)
+		m.Callback.Failure(meterMessages(msgs), err)
+	} else {
+		m.Callback.Success(meterMessages(msgs))
 	}
+}
 
-	//retry attempts to call Ingest API
-	for i := 0; i <= RetryCount; i++ {
-		if i > 0 {
-			m.logf("Ingest Api call retry attempt: %d", i)
+// Send the batch request with retry, returns the number of attempts made
+func (m *Metering) send(msgs []interface{}) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	batch := meterMessages(msgs)
+
+	//retry attempts to write to the sink
+	for attempt := 1; ; attempt++ {
+		var statusCode int
+		var header http.Header
+		err := m.throttle()
+		if err == nil {
+			//the latency excludes the wait for the rate limiter
+			start := m.now()
+			err = m.write(batch)
+			statusCode, header = responseOf(err)
+			m.adapt(m.now().Sub(start), statusCode, err)
 		}
-		if err = m.ingestToApi(b); err == nil {
-			return nil
+		if err == nil {
+			return attempt, nil
+		}
+		atomic.StoreInt64(&m.lastErrorNanos, m.now().UnixNano())
+		delay, retry := m.RetryPolicy.Retry(attempt, statusCode, header, err)
+		if !retry {
+			return attempt, err
+		}
+		atomic.AddUint64(&m.retried, 1)
+		m.logf("Ingest Api call attempt: %d error: %s, retrying in %s", attempt, err.Error(), delay)
+		select {
+		case <-time.After(delay):
+		case <-m.abortCtx.Done():
+			return attempt, fmt.Errorf("retries abandoned after attempt %d: %w", attempt, err)
 		}
-		m.logf("Retry attempt: %d error: %s", i, err.Error())
-		time.Sleep(backoffDelay(i))
 	}
-
-	return err
 }
 
-var retryDelays = []float64{2, 6, 12, 20, 40, 80}
-
-const oneSecond = float64(time.Second)
-
-func backoffDelay(retryNumber int) time.Duration {
-	duration := 80.0
-	if retryNumber < 6 {
-		duration = retryDelays[retryNumber]
+// Wait for the rate limiter to grant the next ingest call
+func (m *Metering) throttle() error {
+	if m.RateLimiter == nil {
+		return nil
+	}
+	if err := m.RateLimiter.Wait(m.abortCtx); err != nil {
+		return fmt.Errorf("ingestToApi()=>Error waiting for the rate limiter: %w", err)
 	}
-	return time.Duration(duration * rand.Float64() * oneSecond)
+	return nil
 }
 
-// Ingest Api Client code
-func (m *Metering) ingestToApi(b []byte) error {
-	m.logf("Ingest API Payload %s", string(b))
-	url := m.Endpoint + "/ingest"
-	_, err := m.AmberfloHttpClient.sendHttpRequest("Ingest Api", url, "POST", b)
-
-	if err != nil {
-		return fmt.Errorf("ingestToApi()=>Error calling ingest API: %s", err)
+// Write the batch to the sink, a ContextSink is interrupted when the retries are abandoned
+func (m *Metering) write(msgs []*MeterMessage) error {
+	if sink, ok := m.Sink.(ContextSink); ok {
+		return sink.WriteContext(m.abortCtx, msgs)
 	}
+	return m.Sink.Write(msgs)
+}
 
-	return nil
+func gzipPayload(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(b); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // Run the listener loop in a separate thread to monitor all channels
 func (m *Metering) loop() {
 	var msgs []interface{}
+	//serialized size of the buffered messages, tracked when MaxBatchBytes is set
+	batchBytes := 0
 	tick := time.NewTicker(m.IntervalSeconds)
 	m.log("Listener thread and timer have started")
-	m.logf("loop() ==> Effective batch size %d interval in seconds %d retry attempts %d", m.BatchSize, m.IntervalSeconds, RetryCount)
+	m.logf("loop() ==> Effective batch size %d interval in seconds %d retry policy %T", m.BatchSize, m.IntervalSeconds, m.RetryPolicy)
+	m.replaySpool()
 
 	for {
 		//select to wait on multiple communication operations
@@ -276,46 +1012,142 @@ func (m *Metering) loop() {
 		select {
 
 		//process new meter message
-		case msg := <-m.msgs:
+		case msg, ok := <-m.msgs:
+			if !ok {
+				//channel closed by shutdown
+				m.drain(tick, msgs)
+				return
+			}
 			m.debugf("buffer (%d/%d) %v", len(msgs), m.BatchSize, msg)
+			size := m.messageBytes(msg)
+			if m.exceedsBatchBytes(len(msgs), batchBytes+size) {
+				m.debugf("exceeded %d bytes – flushing", m.MaxBatchBytes)
+				m.sendAsync(msgs)
+				msgs = make([]interface{}, 0, m.BatchSize)
+				batchBytes = 0
+			}
 			msgs = append(msgs, msg)
+			batchBytes += size
 			if len(msgs) >= m.BatchSize {
 				m.debugf("exceeded %d messages – flushing", m.BatchSize)
 				m.sendAsync(msgs)
 				msgs = make([]interface{}, 0, m.BatchSize)
+				batchBytes = 0
 			}
 
 		//timer event
-		case <-tick.C:
+		case now := <-tick.C:
+			msgs = append(msgs, m.aggregated(now)...)
 			if len(msgs) > 0 {
 				m.debugf("interval reached - flushing %d", len(msgs))
-				m.sendAsync(msgs)
+				m.sendAll(msgs)
 				msgs = make([]interface{}, 0, m.BatchSize)
+				batchBytes = 0
 			} else {
 				m.debug("interval reached – nothing to send")
 			}
 
+		//explicit flush, reply with the batches to wait for
+		case reply := <-m.flush:
+			msgs = m.takeQueued(msgs)
+			msgs = append(msgs, m.aggregated(time.Time{})...)
+			if len(msgs) > 0 {
+				m.debugf("flush requested - flushing %d", len(msgs))
+				m.sendAll(msgs)
+				msgs = make([]interface{}, 0, m.BatchSize)
+				batchBytes = 0
+			}
+			reply <- m.pendingBatches()
+
 		//process shutdown
 		case <-m.quit:
-			//stop the timer
-			tick.Stop()
-			//flush the queue
-			for msg := range m.msgs {
-				m.debugf("queue: (%d/%d) %v", len(msgs), m.BatchSize, msg)
-				msgs = append(msgs, msg)
-			}
-			m.debugf("Flushing %d messages", len(msgs))
-			m.sendAsync(msgs)
-			//wait for all messages to be sent to the API
-			m.wg.Wait()
-			m.log("Queue flushed")
-			//let caller know shutdown is compelete
-			m.shutdown <- struct{}{}
+			m.drain(tick, msgs)
 			return
 		}
 	}
 }
 
+// Send the buffered messages in batches of at most BatchSize messages and MaxBatchBytes
+func (m *Metering) sendAll(msgs []interface{}) {
+	start, batchBytes := 0, 0
+	for i, msg := range msgs {
+		size := m.messageBytes(msg)
+		if i-start >= m.BatchSize || m.exceedsBatchBytes(i-start, batchBytes+size) {
+			m.sendAsync(msgs[start:i:i])
+			start, batchBytes = i, 0
+		}
+		batchBytes += size
+	}
+	if start < len(msgs) {
+		m.sendAsync(msgs[start:])
+	}
+}
+
+// Serialized size of a message within a batch, zero when MaxBatchBytes is not set
+func (m *Metering) messageBytes(msg interface{}) int {
+	if m.MaxBatchBytes <= 0 {
+		return 0
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return 0
+	}
+	//account for the separating comma
+	return len(b) + 1
+}
+
+// Whether a batch of count messages totalling batchBytes, plus the enclosing brackets, exceeds MaxBatchBytes
+func (m *Metering) exceedsBatchBytes(count int, batchBytes int) bool {
+	return m.MaxBatchBytes > 0 && count > 0 && batchBytes+1 > m.MaxBatchBytes
+}
+
+// Aggregates of the buckets ended at now, or of all buckets when now is zero
+func (m *Metering) aggregated(now time.Time) []interface{} {
+	if m.aggregator == nil {
+		return nil
+	}
+	aggregates := m.aggregator.take(now)
+	msgs := make([]interface{}, 0, len(aggregates))
+	for _, msg := range aggregates {
+		msg.setMessageId(m.uid())
+		msg.setTimestamp(timestamp(m.now()))
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// Move the messages already waiting in the channel to the buffer without blocking
+func (m *Metering) takeQueued(msgs []interface{}) []interface{} {
+	for {
+		select {
+		case msg, ok := <-m.msgs:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+// Stop the timer, flush the remaining messages and let the caller know the loop has ended
+func (m *Metering) drain(tick *time.Ticker, msgs []interface{}) {
+	//stop the timer
+	tick.Stop()
+	//flush the queue
+	for msg := range m.msgs {
+		m.debugf("queue: (%d/%d) %v", len(msgs), m.BatchSize, msg)
+		msgs = append(msgs, msg)
+	}
+	msgs = append(msgs, m.aggregated(time.Time{})...)
+	m.debugf("Flushing %d messages", len(msgs))
+	m.sendAll(msgs)
+	m.log("Queue flushed")
+	//let caller know shutdown is compelete
+	close(m.shutdown)
+}
+
 func (m *Metering) debug(args ...interface{}) {
 	if m.Debug {
 		m.Logger.Log(args...)
@@ -348,6 +1180,17 @@ func (m *Message) setMessageId(s string) {
 	}
 }
 
+// Extract the meter messages from a batch
+func meterMessages(msgs []interface{}) []*MeterMessage {
+	result := make([]*MeterMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if meterMessage, ok := msg.(*MeterMessage); ok {
+			result = append(result, meterMessage)
+		}
+	}
+	return result
+}
+
 func timestamp(t time.Time) string {
 	return strftime.Format("%Y-%m-%dT%H:%M:%S%z", t)
 }
@@ -0,0 +1,162 @@
+// Package meteringtest provides an in-memory metering client for unit tests.
+package meteringtest
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/amberflo/metering-go/v2"
+	"github.com/xtgo/uuid"
+)
+
+// TestingT is the subset of testing.TB used by the assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder implements metering.MeteringClient by capturing the meter messages in memory.
+type Recorder struct {
+	mutex    sync.Mutex
+	messages []*metering.MeterMessage
+	shutdown bool
+}
+
+var _ metering.MeteringClient = (*Recorder)(nil)
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Record a copy of the message, validated like metering.Metering.Meter
+func (r *Recorder) Meter(msg *metering.MeterMessage) error {
+	return r.MeterContext(context.Background(), msg)
+}
+
+func (r *Recorder) MeterContext(ctx context.Context, msg *metering.MeterMessage) error {
+	if msg.MeterApiName == "" {
+		return validationError("'MeterName' is required field")
+	}
+	if msg.MeterTimeInMillis < 1 {
+		return validationError("invalid UtcTimeMillis: should be milliseconds in UTC")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	//the metering client fills in a blank UniqueId the same way
+	if strings.Trim(msg.UniqueId, " ") == "" {
+		msg.UniqueId = uuid.NewRandom().String()
+	}
+
+	copied := *msg
+	if msg.Dimensions != nil {
+		copied.Dimensions = make(map[string]string, len(msg.Dimensions))
+		for k, v := range msg.Dimensions {
+			copied.Dimensions[k] = v
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.shutdown {
+		return metering.ErrClosed
+	}
+	r.messages = append(r.messages, &copied)
+	return nil
+}
+
+func (r *Recorder) Shutdown() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.shutdown = true
+	return nil
+}
+
+// Messages recorded so far, in the order they were metered
+func (r *Recorder) Messages() []*metering.MeterMessage {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*metering.MeterMessage(nil), r.messages...)
+}
+
+// Messages recorded for the meter and customer, cancellations included
+func (r *Recorder) MessagesFor(meterApiName string, customerId string) []*metering.MeterMessage {
+	var result []*metering.MeterMessage
+	for _, msg := range r.Messages() {
+		if msg.MeterApiName == meterApiName && msg.CustomerId == customerId {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// Sum of the values metered for the meter and customer, leaving out cancelled meters
+func (r *Recorder) TotalFor(meterApiName string, customerId string) float64 {
+	msgs := r.MessagesFor(meterApiName, customerId)
+
+	cancelled := make(map[string]bool)
+	for _, msg := range msgs {
+		if isCancellation(msg) {
+			cancelled[msg.UniqueId] = true
+		}
+	}
+
+	total := 0.0
+	for _, msg := range msgs {
+		if isCancellation(msg) || (msg.UniqueId != "" && cancelled[msg.UniqueId]) {
+			continue
+		}
+		total += msg.MeterValue
+	}
+	return total
+}
+
+// Assert that the total metered for the meter and customer equals value
+func (r *Recorder) AssertMetered(t TestingT, meterApiName string, customerId string, value float64) bool {
+	t.Helper()
+	msgs := r.MessagesFor(meterApiName, customerId)
+	if len(msgs) == 0 {
+		t.Errorf("meteringtest: nothing metered for meter '%s' and customer '%s'", meterApiName, customerId)
+		return false
+	}
+	total := r.TotalFor(meterApiName, customerId)
+	if math.Abs(total-value) > 1e-9*math.Max(1, math.Abs(value)) {
+		t.Errorf("meteringtest: meter '%s' customer '%s' total is %v, expected %v", meterApiName, customerId, total, value)
+		return false
+	}
+	return true
+}
+
+// Assert that nothing was metered for the meter and customer
+func (r *Recorder) AssertNotMetered(t TestingT, meterApiName string, customerId string) bool {
+	t.Helper()
+	if msgs := r.MessagesFor(meterApiName, customerId); len(msgs) > 0 {
+		t.Errorf("meteringtest: %d messages metered for meter '%s' and customer '%s'", len(msgs), meterApiName, customerId)
+		return false
+	}
+	return true
+}
+
+// Forget the recorded messages
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.messages = nil
+}
+
+func isCancellation(msg *metering.MeterMessage) bool {
+	return msg.Dimensions[metering.CancelMeter] == "true"
+}
+
+// Error of a rejected message, matching metering.ErrValidation like the errors of the metering client
+type validationError string
+
+func (e validationError) Error() string {
+	return string(e)
+}
+
+func (e validationError) Is(target error) bool {
+	return target == metering.ErrValidation
+}
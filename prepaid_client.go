@@ -1,8 +1,8 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 )
 
@@ -53,6 +53,10 @@ type ExternalPrepaidPaymentStatus struct {
 }
 
 func (pc *PrepaidClient) CreatePrepaidOrder(customerPrepaidOrder *CustomerPrepaid) (*CustomerPrepaid, error) {
+	return pc.CreatePrepaidOrderContext(context.Background(), customerPrepaidOrder)
+}
+
+func (pc *PrepaidClient) CreatePrepaidOrderContext(ctx context.Context, customerPrepaidOrder *CustomerPrepaid) (*CustomerPrepaid, error) {
 	signature := fmt.Sprintf("CreatePrepaidOrder(%v): ", customerPrepaidOrder)
 
 	if customerPrepaidOrder.ProductId == "" {
@@ -65,11 +69,11 @@ func (pc *PrepaidClient) CreatePrepaidOrder(customerPrepaidOrder *CustomerPrepai
 	}
 
 	pc.logf("%s json payload %s", signature, string(bytes))
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid", Endpoint)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest(apiName, url, "POST", bytes)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid", pc.BaseURL)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "POST", bytes)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	err = json.Unmarshal(body, &customerPrepaidOrder)
@@ -81,11 +85,15 @@ func (pc *PrepaidClient) CreatePrepaidOrder(customerPrepaidOrder *CustomerPrepai
 }
 
 func (pc *PrepaidClient) UpdateExternalPrepaidStatus(externalPrepaidPaymentStatus *ExternalPrepaidPaymentStatus) (*ExternalPrepaidPaymentStatus, error) {
+	return pc.UpdateExternalPrepaidStatusContext(context.Background(), externalPrepaidPaymentStatus)
+}
+
+func (pc *PrepaidClient) UpdateExternalPrepaidStatusContext(ctx context.Context, externalPrepaidPaymentStatus *ExternalPrepaidPaymentStatus) (*ExternalPrepaidPaymentStatus, error) {
 	signature := fmt.Sprintf("UpdateExternalPrepaidStatus(%v): ", externalPrepaidPaymentStatus)
 
 	paymentStatus := externalPrepaidPaymentStatus.PaymentStatus
 	if paymentStatus != SETTLED && paymentStatus != FAILED && paymentStatus != PENDING {
-		return nil, fmt.Errorf("%s: %s", signature, errors.New("only (SETTLED, FAILED, PENDING) allowed as 'paymentStatus'"))
+		return nil, fmt.Errorf("%s: %w", signature, invalidRequest("only (SETTLED, FAILED, PENDING) allowed as 'paymentStatus'"))
 	}
 
 	bytes, err := json.Marshal(externalPrepaidPaymentStatus)
@@ -94,11 +102,11 @@ func (pc *PrepaidClient) UpdateExternalPrepaidStatus(externalPrepaidPaymentStatu
 	}
 
 	pc.logf("%s json payload %s", signature, string(bytes))
-	url := fmt.Sprintf("%s/payments/external/prepaid-payment-status", Endpoint)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest(apiName, url, "POST", bytes)
+	url := fmt.Sprintf("%s/payments/external/prepaid-payment-status", pc.BaseURL)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "POST", bytes)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	err = json.Unmarshal(body, &externalPrepaidPaymentStatus)
@@ -110,18 +118,22 @@ func (pc *PrepaidClient) UpdateExternalPrepaidStatus(externalPrepaidPaymentStatu
 }
 
 func (pc *PrepaidClient) GetActivePrepaidOrders(customerId string) ([]CustomerPrepaid, error) {
+	return pc.GetActivePrepaidOrdersContext(context.Background(), customerId)
+}
+
+func (pc *PrepaidClient) GetActivePrepaidOrdersContext(ctx context.Context, customerId string) ([]CustomerPrepaid, error) {
 	signature := fmt.Sprintf("GetActivePrepaidOrders(%s): ", customerId)
 
 	if customerId == "" {
-		return nil, fmt.Errorf("%s: %s", signature, errors.New("'customerId' is required"))
+		return nil, fmt.Errorf("%s: %w", signature, invalidRequest("'customerId' is required"))
 	}
 
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid/list?CustomerId=%s", Endpoint, customerId)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid/list?CustomerId=%s", pc.BaseURL, customerId)
 	pc.logf("%s calling API %s", signature, url)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest(apiName, url, "GET", nil)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "GET", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	var customerPrepaidOrders []CustomerPrepaid
@@ -134,18 +146,22 @@ func (pc *PrepaidClient) GetActivePrepaidOrders(customerId string) ([]CustomerPr
 }
 
 func (pc *PrepaidClient) DeletePrepaidOrder(id string, customerId string) error {
+	return pc.DeletePrepaidOrderContext(context.Background(), id, customerId)
+}
+
+func (pc *PrepaidClient) DeletePrepaidOrderContext(ctx context.Context, id string, customerId string) error {
 	signature := fmt.Sprintf("DeletePrepaidOrder(%s, %s): ", id, customerId)
 
 	if id == "" || customerId == "" {
-		return fmt.Errorf("%s: %s", signature, errors.New("'id' and 'customerId' are required"))
+		return fmt.Errorf("%s: %w", signature, invalidRequest("'id' and 'customerId' are required"))
 	}
 
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid?Id=%s&CustomerId=%s", Endpoint, id, customerId)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-prepaid?Id=%s&CustomerId=%s", pc.BaseURL, id, customerId)
 	pc.logf("%s calling API %s", signature, url)
-	_, err := pc.AmberfloHttpClient.sendHttpRequest(apiName, url, "DELETE", nil)
+	_, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, apiName, url, "DELETE", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return fmt.Errorf("API error: %s", err)
+		return fmt.Errorf("API error: %w", err)
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -48,9 +49,9 @@ type ApplyPromotionRequest struct {
 }
 
 type RemovePromotionRequest struct {
-	CustomerId  string `json:"customerId"`
-	Id          string `json:"id"`
-	RelationId  string `json:"relationId"`
+	CustomerId string `json:"customerId"`
+	Id         string `json:"id"`
+	RelationId string `json:"relationId"`
 }
 
 type PromotionRecurrenceInterval struct {
@@ -101,6 +102,10 @@ type Promotion struct {
 }
 
 func (pc *PromotionClient) ApplyPromotion(request *ApplyPromotionRequest) (*CustomerAppliedPromotion, error) {
+	return pc.ApplyPromotionContext(context.Background(), request)
+}
+
+func (pc *PromotionClient) ApplyPromotionContext(ctx context.Context, request *ApplyPromotionRequest) (*CustomerAppliedPromotion, error) {
 	signature := fmt.Sprintf("ApplyPromotion(%v): ", request)
 
 	request.ProductId = "1"
@@ -111,11 +116,11 @@ func (pc *PromotionClient) ApplyPromotion(request *ApplyPromotionRequest) (*Cust
 	}
 
 	pc.logf("%s json payload %s", signature, string(bytes))
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions", Endpoint)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest("Customer Promotions", url, "POST", bytes)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions", pc.BaseURL)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Customer Promotions", url, "POST", bytes)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	var appliedPromotion CustomerAppliedPromotion
@@ -129,13 +134,17 @@ func (pc *PromotionClient) ApplyPromotion(request *ApplyPromotionRequest) (*Cust
 }
 
 func (pc *PromotionClient) ListAppliedPromotion(customerId string) (*[]CustomerAppliedPromotion, error) {
+	return pc.ListAppliedPromotionContext(context.Background(), customerId)
+}
+
+func (pc *PromotionClient) ListAppliedPromotionContext(ctx context.Context, customerId string) (*[]CustomerAppliedPromotion, error) {
 	signature := fmt.Sprintf("ListAppliedPromotions(%s): ", customerId)
 
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions/list?ProductId=1&CustomerId=%s", Endpoint, customerId)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest("Customer Promotions", url, "GET", nil)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions/list?ProductId=1&CustomerId=%s", pc.BaseURL, customerId)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Customer Promotions", url, "GET", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	var appliedPromotions []CustomerAppliedPromotion
@@ -149,27 +158,35 @@ func (pc *PromotionClient) ListAppliedPromotion(customerId string) (*[]CustomerA
 }
 
 func (pc *PromotionClient) RemovePromotion(request *RemovePromotionRequest) error {
+	return pc.RemovePromotionContext(context.Background(), request)
+}
+
+func (pc *PromotionClient) RemovePromotionContext(ctx context.Context, request *RemovePromotionRequest) error {
 	signature := fmt.Sprintf("RemovePromotion(%s): ", request)
 
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions?CustomerId=%s&Id=%s", Endpoint, request.CustomerId, request.Id)
-	_, err := pc.AmberfloHttpClient.sendHttpRequest("Customer Promotions", url, "DELETE", nil)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/customer-promotions?CustomerId=%s&Id=%s", pc.BaseURL, request.CustomerId, request.Id)
+	_, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Customer Promotions", url, "DELETE", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return fmt.Errorf("API error: %s", err)
+		return fmt.Errorf("API error: %w", err)
 	}
 
 	return nil
 }
 
 func (pc *PromotionClient) ListPromotions() (*[]Promotion, error) {
+	return pc.ListPromotionsContext(context.Background())
+}
+
+func (pc *PromotionClient) ListPromotionsContext(ctx context.Context) (*[]Promotion, error) {
 	signature := "ListPromotions(): "
 
 	pc.logf("%s payload %s", signature)
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/account-pricing/promotions/list", Endpoint)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest("Promotions", url, "GET", nil)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/account-pricing/promotions/list", pc.BaseURL)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Promotions", url, "GET", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	var promotions []Promotion
@@ -183,14 +200,18 @@ func (pc *PromotionClient) ListPromotions() (*[]Promotion, error) {
 }
 
 func (pc *PromotionClient) GetPromotionById(id string) (*Promotion, error) {
+	return pc.GetPromotionByIdContext(context.Background(), id)
+}
+
+func (pc *PromotionClient) GetPromotionByIdContext(ctx context.Context, id string) (*Promotion, error) {
 	signature := fmt.Sprintf("GetPromotionById(%s): ", id)
 
 	pc.logf("%s", signature)
-	url := fmt.Sprintf("%s/payments/pricing/amberflo/account-pricing/promotions?id=%s", Endpoint, id)
-	body, err := pc.AmberfloHttpClient.sendHttpRequest("Promotions", url, "GET", nil)
+	url := fmt.Sprintf("%s/payments/pricing/amberflo/account-pricing/promotions?id=%s", pc.BaseURL, id)
+	body, err := pc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Promotions", url, "GET", nil)
 	if err != nil {
 		pc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	var promotion Promotion
@@ -0,0 +1,97 @@
+package metering
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExceeded is returned by a fail-fast RateLimiter when no request token is available.
+var ErrRateLimitExceeded = errors.New("client-side rate limit exceeded")
+
+// Token bucket limiting the requests sent to the Amberflo API. Share one
+// RateLimiter between clients to apply an account-level limit to all of them.
+type RateLimiter struct {
+	// FailFast makes requests over the limit return ErrRateLimitExceeded
+	// instead of waiting for a token.
+	FailFast bool
+
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// Allow requestsPerSecond on average and bursts of up to burst requests, blocking by default
+func NewRateLimiter(requestsPerSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   requestsPerSecond,
+		burst:  float64(burst),
+		now:    time.Now,
+		tokens: float64(burst),
+	}
+}
+
+// Take a token, waiting for one unless FailFast is set or the context is done first
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mutex.Lock()
+	now := l.now()
+	l.refill(now)
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mutex.Unlock()
+		return nil
+	}
+	if l.FailFast || l.rate <= 0 {
+		l.mutex.Unlock()
+		return ErrRateLimitExceeded
+	}
+
+	//reserve the next token and wait for it to be refilled
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	l.tokens--
+	l.mutex.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		//give the reserved token back
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Take a token if one is available without waiting
+func (l *RateLimiter) Allow() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.refill(l.now())
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// Add the tokens accumulated since the last call, callers hold the mutex
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
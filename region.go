@@ -0,0 +1,62 @@
+package metering
+
+import "strings"
+
+// Hosts of an Amberflo deployment
+type Region struct {
+	Name string
+	// BaseURL is the base URL of the REST API used by the clients.
+	BaseURL string
+	// IngestEndpoint is the base URL of the ingest API used by Metering.
+	IngestEndpoint string
+}
+
+// Other deployments are reached with CustomRegion
+var RegionUS = Region{Name: "us", BaseURL: Endpoint, IngestEndpoint: IngestEndpoint}
+
+// Region serving both APIs from custom hosts, for example a proxy or a local stand-in.
+// The ingest API is served from baseURL when ingestEndpoint is empty.
+func CustomRegion(baseURL string, ingestEndpoint string) Region {
+	if ingestEndpoint == "" {
+		ingestEndpoint = baseURL
+	}
+	return Region{
+		Name:           "custom",
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		IngestEndpoint: strings.TrimRight(ingestEndpoint, "/"),
+	}
+}
+
+// Look up a predefined region by name, for example from configuration
+func RegionByName(name string) (Region, bool) {
+	for _, region := range []Region{RegionUS} {
+		if strings.EqualFold(region.Name, name) {
+			return region, true
+		}
+	}
+	return Region{}, false
+}
+
+// Send the requests to the REST API of region
+func WithRegion(region Region) ClientOption {
+	return WithBaseURL(region.BaseURL)
+}
+
+// Send the requests to baseURL instead of Endpoint, for example a proxy or a local stand-in.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(u *BaseClient) {
+		u.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+}
+
+// Send the meters to the ingest API of region
+func WithMeteringRegion(region Region) MeteringOption {
+	return WithIngestEndpoint(region.IngestEndpoint)
+}
+
+// Send the meters to endpoint instead of IngestEndpoint.
+func WithIngestEndpoint(endpoint string) MeteringOption {
+	return func(m *Metering) {
+		m.Endpoint = strings.TrimRight(endpoint, "/")
+	}
+}
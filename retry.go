@@ -0,0 +1,92 @@
+package metering
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides whether a failed API call is retried and how long to
+// wait before the next attempt.
+type RetryPolicy interface {
+	// Retry is called after the given attempt (starting at 1) failed. statusCode
+	// and header describe the error response, they are 0 and nil when no
+	// response was received.
+	Retry(attempt int, statusCode int, header http.Header, err error) (time.Duration, bool)
+}
+
+// Exponential backoff with full jitter. Client errors other than 408 and 429
+// are not retried and a Retry-After header takes precedence over the backoff,
+// capped at MaxDelay.
+type DefaultRetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func NewDefaultRetryPolicy() *DefaultRetryPolicy {
+	return &DefaultRetryPolicy{
+		MaxRetries: RetryCount,
+		BaseDelay:  2 * time.Second,
+		MaxDelay:   80 * time.Second,
+	}
+}
+
+func (p *DefaultRetryPolicy) Retry(attempt int, statusCode int, header http.Header, err error) (time.Duration, bool) {
+	if attempt > p.MaxRetries {
+		return 0, false
+	}
+	if rejected(statusCode) {
+		return 0, false
+	}
+	if delay, ok := retryAfter(header, time.Now()); ok {
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		return delay, true
+	}
+
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 32 {
+		if backoff := p.BaseDelay << uint(shift); backoff > 0 && backoff < p.MaxDelay {
+			delay = backoff
+		}
+	}
+	return time.Duration(rand.Float64() * float64(delay)), true
+}
+
+// Client errors other than 408 and 429 fail the same way on every attempt
+func rejected(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 &&
+		statusCode != http.StatusRequestTimeout && statusCode != http.StatusTooManyRequests
+}
+
+// Parse the Retry-After header, either delay seconds or an HTTP date
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Status code and headers of the error response behind err, if any
+func responseOf(err error) (int, http.Header) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.Header
+	}
+	return 0, nil
+}
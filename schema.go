@@ -0,0 +1,145 @@
+package metering
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+// Expected shape of the messages of a meter
+type MeterSchema struct {
+	MeterApiName string `json:"meterApiName"`
+	// RequiredDimensions must be present on every message.
+	RequiredDimensions []string `json:"requiredDimensions,omitempty"`
+	// AllowedDimensions lists the optional dimensions, any dimension is allowed when empty.
+	AllowedDimensions []string `json:"allowedDimensions,omitempty"`
+	MinValue          *float64 `json:"minValue,omitempty"`
+	MaxValue          *float64 `json:"maxValue,omitempty"`
+	AllowNegative     bool     `json:"allowNegative"`
+}
+
+// Error returned when a message does not conform to the schema of its meter
+type ValidationError struct {
+	MeterApiName string
+	// Field is the offending field, for example "meterValue" or "dimensions.region".
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("meter '%s' field '%s': %s", e.MeterApiName, e.Field, e.Reason)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// Registry of the schemas of the meters a service emits
+type SchemaRegistry struct {
+	// AllowUnknownMeters accepts messages of meters without a registered schema.
+	AllowUnknownMeters bool
+
+	mutex   sync.RWMutex
+	schemas map[string]*MeterSchema
+}
+
+// Layout of a schema registry JSON file
+type schemaRegistryFile struct {
+	AllowUnknownMeters bool           `json:"allowUnknownMeters"`
+	Meters             []*MeterSchema `json:"meters"`
+}
+
+func NewSchemaRegistry(schemas ...*MeterSchema) *SchemaRegistry {
+	r := &SchemaRegistry{schemas: make(map[string]*MeterSchema)}
+	for _, schema := range schemas {
+		r.Register(schema)
+	}
+	return r
+}
+
+// Load a registry from a JSON file of the form {"allowUnknownMeters": false, "meters": [...]}
+func LoadSchemaRegistry(path string) (*SchemaRegistry, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema file: %s", err)
+	}
+
+	var file schemaRegistryFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("error parsing schema file %s: %s", path, err)
+	}
+
+	r := NewSchemaRegistry(file.Meters...)
+	r.AllowUnknownMeters = file.AllowUnknownMeters
+	return r, nil
+}
+
+func (r *SchemaRegistry) Register(schema *MeterSchema) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.schemas[schema.MeterApiName] = schema
+}
+
+func (r *SchemaRegistry) Schema(meterApiName string) (*MeterSchema, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	schema, ok := r.schemas[meterApiName]
+	return schema, ok
+}
+
+// Validate the message against the schema of its meter, returns a *ValidationError
+func (r *SchemaRegistry) Validate(msg *MeterMessage) error {
+	schema, ok := r.Schema(msg.MeterApiName)
+	if !ok {
+		if r.AllowUnknownMeters {
+			return nil
+		}
+		return &ValidationError{MeterApiName: msg.MeterApiName, Field: "meterApiName", Reason: "unknown meter"}
+	}
+	return schema.Validate(msg)
+}
+
+// Validate the message against the schema, returns a *ValidationError
+func (s *MeterSchema) Validate(msg *MeterMessage) error {
+	invalid := func(field string, format string, args ...interface{}) error {
+		return &ValidationError{MeterApiName: s.MeterApiName, Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	//a cancellation only carries the id of the meter it cancels
+	if msg.Dimensions[CancelMeter] == "true" {
+		return nil
+	}
+	for _, key := range s.RequiredDimensions {
+		if _, ok := msg.Dimensions[key]; !ok {
+			return invalid("dimensions."+key, "required dimension is missing")
+		}
+	}
+	if len(s.AllowedDimensions) > 0 {
+		for key := range msg.Dimensions {
+			if key != CancelMeter && !contains(s.AllowedDimensions, key) && !contains(s.RequiredDimensions, key) {
+				return invalid("dimensions."+key, "dimension is not allowed")
+			}
+		}
+	}
+
+	if msg.MeterValue < 0 && !s.AllowNegative {
+		return invalid("meterValue", "negative value %v is not allowed", msg.MeterValue)
+	}
+	if s.MinValue != nil && msg.MeterValue < *s.MinValue {
+		return invalid("meterValue", "value %v is less than %v", msg.MeterValue, *s.MinValue)
+	}
+	if s.MaxValue != nil && msg.MeterValue > *s.MaxValue {
+		return invalid("meterValue", "value %v is greater than %v", msg.MeterValue, *s.MaxValue)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,8 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 )
 
@@ -71,45 +71,61 @@ type Notification struct {
 }
 
 func (sc *SignalsClient) CreateSignal(notification *Notification) (*Notification, error) {
+	return sc.CreateSignalContext(context.Background(), notification)
+}
+
+func (sc *SignalsClient) CreateSignalContext(ctx context.Context, notification *Notification) (*Notification, error) {
 	signature := fmt.Sprintf("CreateSignal(%v): ", notification)
-	url := fmt.Sprintf("%s/notification", Endpoint)
-	return sc.wrapSignalRequest(signature, url, "POST", notification)
+	url := fmt.Sprintf("%s/notification", sc.BaseURL)
+	return sc.wrapSignalRequest(ctx, signature, url, "POST", notification)
 }
 
 func (sc *SignalsClient) UpdateSignal(notification *Notification) (*Notification, error) {
+	return sc.UpdateSignalContext(context.Background(), notification)
+}
+
+func (sc *SignalsClient) UpdateSignalContext(ctx context.Context, notification *Notification) (*Notification, error) {
 	signature := fmt.Sprintf("UpdateSignal(%v): ", notification)
 
 	if notification.Id == "" {
-		return nil, fmt.Errorf("%s: %s", signature, errors.New("'Id' is required"))
+		return nil, fmt.Errorf("%s: %w", signature, invalidRequest("'Id' is required"))
 	}
 
-	url := fmt.Sprintf("%s/notification", Endpoint)
-	return sc.wrapSignalRequest(signature, url, "PUT", notification)
+	url := fmt.Sprintf("%s/notification", sc.BaseURL)
+	return sc.wrapSignalRequest(ctx, signature, url, "PUT", notification)
 }
 
 func (sc *SignalsClient) GetSignal(notificationId string) (*Notification, error) {
+	return sc.GetSignalContext(context.Background(), notificationId)
+}
+
+func (sc *SignalsClient) GetSignalContext(ctx context.Context, notificationId string) (*Notification, error) {
 	signature := fmt.Sprintf("GetSignal(%s): ", notificationId)
 
 	if notificationId == "" {
-		return nil, fmt.Errorf("%s: %s", signature, errors.New("'notificationId' is required"))
+		return nil, fmt.Errorf("%s: %w", signature, invalidRequest("'notificationId' is required"))
 	}
 
-	url := fmt.Sprintf("%s/notification/%s", Endpoint, notificationId)
-	return sc.wrapSignalRequest(signature, url, "GET", nil)
+	url := fmt.Sprintf("%s/notification/%s", sc.BaseURL, notificationId)
+	return sc.wrapSignalRequest(ctx, signature, url, "GET", nil)
 }
 
 func (sc *SignalsClient) DeleteSignal(notificationId string) (*Notification, error) {
+	return sc.DeleteSignalContext(context.Background(), notificationId)
+}
+
+func (sc *SignalsClient) DeleteSignalContext(ctx context.Context, notificationId string) (*Notification, error) {
 	signature := fmt.Sprintf("DeleteSignal(%s): ", notificationId)
 
 	if notificationId == "" {
-		return nil, fmt.Errorf("%s: %s", signature, errors.New("'notificationId' is required"))
+		return nil, fmt.Errorf("%s: %w", signature, invalidRequest("'notificationId' is required"))
 	}
 
-	url := fmt.Sprintf("%s/notification/%s", Endpoint, notificationId)
-	return sc.wrapSignalRequest(signature, url, "DELETE", nil)
+	url := fmt.Sprintf("%s/notification/%s", sc.BaseURL, notificationId)
+	return sc.wrapSignalRequest(ctx, signature, url, "DELETE", nil)
 }
 
-func (sc *SignalsClient) wrapSignalRequest(signature string, url string, httpMethod string, notification *Notification) (*Notification, error) {
+func (sc *SignalsClient) wrapSignalRequest(ctx context.Context, signature string, url string, httpMethod string, notification *Notification) (*Notification, error) {
 	var bytes []byte
 	var err error
 
@@ -122,10 +138,10 @@ func (sc *SignalsClient) wrapSignalRequest(signature string, url string, httpMet
 	}
 
 	//call API
-	body, err := sc.AmberfloHttpClient.sendHttpRequest("Signals", url, httpMethod, bytes)
+	body, err := sc.AmberfloHttpClient.sendHttpRequestContext(ctx, "Signals", url, httpMethod, bytes)
 	if err != nil {
 		sc.logf("%s API error: %s", signature, err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	//deserialize API result
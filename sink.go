@@ -0,0 +1,246 @@
+package metering
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives the batches of meter messages sent by the Metering client.
+// A failed Write is retried according to the RetryPolicy.
+type Sink interface {
+	Write(msgs []*MeterMessage) error
+}
+
+// ContextSink is a Sink whose writes can be interrupted. The Metering client
+// cancels ctx when shutdown abandons the batches in flight.
+type ContextSink interface {
+	Sink
+	WriteContext(ctx context.Context, msgs []*MeterMessage) error
+}
+
+// Sink posting the batches to the Amberflo ingest API, the default sink
+type HttpSink struct {
+	// Endpoint is the base URL of the ingest API.
+	Endpoint           string
+	Compression        Compression
+	AmberfloHttpClient AmberfloHttpClient
+}
+
+// HttpSink with the default settings, WithAdditionalSinks combines other sinks
+// with the HttpSink configured by the metering client instead.
+func NewHttpSink(apiKey string) *HttpSink {
+	return &HttpSink{
+		Endpoint:           IngestEndpoint,
+		AmberfloHttpClient: *NewAmberfloHttpClient(apiKey, NewAmberfloDefaultLogger(), *http.DefaultClient),
+	}
+}
+
+// Sink built from the configuration of the metering client
+func newHttpSink(m *Metering) *HttpSink {
+	return &HttpSink{
+		Endpoint:           m.Endpoint,
+		Compression:        m.Compression,
+		AmberfloHttpClient: m.AmberfloHttpClient,
+	}
+}
+
+func (s *HttpSink) Write(msgs []*MeterMessage) error {
+	return s.WriteContext(context.Background(), msgs)
+}
+
+func (s *HttpSink) WriteContext(ctx context.Context, msgs []*MeterMessage) error {
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		return fmt.Errorf("error marshalling msgs: %s", err)
+	}
+
+	s.AmberfloHttpClient.logf("Ingest API Payload %s", string(b))
+	params := &HttpParams{
+		ApiName:    "Ingest Api",
+		Url:        s.Endpoint + "/ingest",
+		HttpMethod: "POST",
+		Payload:    b,
+	}
+	if s.Compression == Gzip {
+		compressed, err := gzipPayload(b)
+		if err != nil {
+			return fmt.Errorf("ingestToApi()=>Error compressing payload: %s", err)
+		}
+		params.Payload = compressed
+		params.Header = http.Header{"Content-Encoding": []string{"gzip"}}
+	}
+
+	if _, err := s.AmberfloHttpClient.send(ctx, params); err != nil {
+		return fmt.Errorf("ingestToApi()=>Error calling ingest API: %w", err)
+	}
+	return nil
+}
+
+// Sink appending every message as a JSON line to a file. The file is rotated
+// once it reaches MaxBytes and at most MaxBackups rotated files are kept.
+type FileSink struct {
+	Path string
+	// MaxBytes disables rotation when 0.
+	MaxBytes int64
+	// MaxBackups keeps every rotated file when 0.
+	MaxBackups int
+
+	mutex sync.Mutex
+}
+
+func NewFileSink(path string, maxBytes int64, maxBackups int) *FileSink {
+	return &FileSink{Path: path, MaxBytes: maxBytes, MaxBackups: maxBackups}
+}
+
+func (s *FileSink) Write(msgs []*MeterMessage) error {
+	lines, err := ndjson(msgs)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.MaxBytes > 0 {
+		info, err := os.Stat(s.Path)
+		if err == nil && info.Size() > 0 && info.Size()+int64(len(lines)) > s.MaxBytes {
+			if err := s.rotate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening sink file: %s", err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(lines); err != nil {
+		return fmt.Errorf("error writing sink file: %s", err)
+	}
+	return file.Sync()
+}
+
+// Timestamp suffix of the files rotated by a FileSink
+const backupLayout = "20060102T150405.000000000"
+
+// Rename the current file with a timestamp suffix and remove the oldest backups
+func (s *FileSink) rotate() error {
+	rotated := fmt.Sprintf("%s.%s", s.Path, time.Now().UTC().Format(backupLayout))
+	if err := os.Rename(s.Path, rotated); err != nil {
+		return fmt.Errorf("error rotating sink file: %s", err)
+	}
+	if s.MaxBackups <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(s.Path + ".*")
+	if err != nil {
+		return fmt.Errorf("error listing sink files: %s", err)
+	}
+	//only the files rotated by the sink are backups, other files next to it are left alone
+	var backups []string
+	for _, match := range matches {
+		if _, err := time.Parse(backupLayout, strings.TrimPrefix(match, s.Path+".")); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	//timestamp suffixes sort from the oldest to the newest
+	sort.Strings(backups)
+	for len(backups) > s.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return fmt.Errorf("error removing sink file: %s", err)
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Sink writing every message as a JSON line to a writer
+type WriterSink struct {
+	Writer io.Writer
+	mutex  sync.Mutex
+}
+
+func NewWriterSink(writer io.Writer) *WriterSink {
+	return &WriterSink{Writer: writer}
+}
+
+// Sink writing every message as a JSON line to the standard output
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *WriterSink) Write(msgs []*MeterMessage) error {
+	lines, err := ndjson(msgs)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, err := s.Writer.Write(lines); err != nil {
+		return fmt.Errorf("error writing to sink: %s", err)
+	}
+	return nil
+}
+
+// Sink writing every batch to all of its sinks. A batch failing on any sink
+// is retried on all of them, so the other sinks may receive it more than once.
+type FanOutSink struct {
+	Sinks []Sink
+}
+
+func NewFanOutSink(sinks ...Sink) *FanOutSink {
+	return &FanOutSink{Sinks: sinks}
+}
+
+func (s *FanOutSink) Write(msgs []*MeterMessage) error {
+	return s.WriteContext(context.Background(), msgs)
+}
+
+func (s *FanOutSink) WriteContext(ctx context.Context, msgs []*MeterMessage) error {
+	var errs []error
+	for _, sink := range s.Sinks {
+		var err error
+		if contextSink, ok := sink.(ContextSink); ok {
+			err = contextSink.WriteContext(ctx, msgs)
+		} else {
+			err = sink.Write(msgs)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%d of %d sinks failed, first error: %w", len(errs), len(s.Sinks), errs[0])
+	}
+}
+
+// Encode the messages as newline delimited JSON
+func ndjson(msgs []*MeterMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, msg := range msgs {
+		if err := encoder.Encode(msg); err != nil {
+			return nil, fmt.Errorf("error marshalling msgs: %s", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
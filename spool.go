@@ -0,0 +1,325 @@
+package metering
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSpoolSegmentBytes = 4 << 20
+	spoolSegmentExt          = ".seg"
+)
+
+// A line of a spool segment: either a batch of messages or the
+// acknowledgement that a batch was ingested.
+type spoolRecord struct {
+	Batch    string          `json:"batch,omitempty"`
+	Messages []*MeterMessage `json:"messages,omitempty"`
+	Ack      string          `json:"ack,omitempty"`
+}
+
+// An append-only segment file of the spool
+type spoolSegment struct {
+	path    string
+	file    *os.File
+	size    int64
+	created time.Time
+	pending map[string]struct{}
+	sealed  bool
+	deleted bool
+}
+
+// Reference to a spooled batch
+type spoolEntry struct {
+	segment *spoolSegment
+	id      string
+}
+
+// A spooled batch left over by a previous process
+type spoolBatch struct {
+	entry    *spoolEntry
+	messages []*MeterMessage
+}
+
+// Durable on-disk spool: every batch is written to the current segment before
+// it is sent, and a segment is deleted once all of its batches are acknowledged.
+type spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+	maxAge       time.Duration
+	logger       Logger
+	uid          func() string
+	now          func() time.Time
+
+	mutex    sync.Mutex
+	current  *spoolSegment
+	segments []*spoolSegment
+}
+
+// Open the spool directory and load the batches that were not acknowledged
+func openSpool(m *Metering) (*spool, []*spoolBatch, error) {
+	if err := os.MkdirAll(m.SpoolDir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("error creating spool directory: %s", err)
+	}
+
+	s := &spool{
+		dir:          m.SpoolDir,
+		segmentBytes: m.SpoolSegmentBytes,
+		maxBytes:     m.SpoolMaxBytes,
+		maxAge:       m.SpoolMaxAge,
+		logger:       m.Logger,
+		uid:          m.uid,
+		now:          m.now,
+	}
+	if s.segmentBytes <= 0 {
+		s.segmentBytes = DefaultSpoolSegmentBytes
+	}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading spool directory: %s", err)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	var leftovers []*spoolBatch
+	for _, info := range files {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), spoolSegmentExt) {
+			continue
+		}
+		segment := &spoolSegment{
+			path:    filepath.Join(s.dir, info.Name()),
+			size:    info.Size(),
+			created: info.ModTime(),
+			pending: make(map[string]struct{}),
+			sealed:  true,
+		}
+		batches, err := s.load(segment)
+		if err != nil {
+			s.logger.Logf("spool: skipping segment %s: %s", segment.path, err)
+			continue
+		}
+		if len(segment.pending) == 0 {
+			s.remove(segment)
+			continue
+		}
+		s.segments = append(s.segments, segment)
+		leftovers = append(leftovers, batches...)
+	}
+	s.enforceRetention()
+
+	//drop the leftovers of segments removed by the retention limits
+	kept := leftovers[:0]
+	for _, b := range leftovers {
+		if !b.entry.segment.deleted {
+			kept = append(kept, b)
+		}
+	}
+	return s, kept, nil
+}
+
+// Read the unacknowledged batches of a segment
+func (s *spool) load(segment *spoolSegment) ([]*spoolBatch, error) {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var batches []*spoolBatch
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record spoolRecord
+			if jsonErr := json.Unmarshal(line, &record); jsonErr != nil {
+				//a partially written record, the process stopped while appending it
+				s.logger.Logf("spool: ignoring corrupt record in %s: %s", segment.path, jsonErr)
+			} else if record.Ack != "" {
+				delete(segment.pending, record.Ack)
+			} else {
+				segment.pending[record.Batch] = struct{}{}
+				batches = append(batches, &spoolBatch{
+					entry:    &spoolEntry{segment: segment, id: record.Batch},
+					messages: record.Messages,
+				})
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	//keep only the batches without acknowledgement
+	unacked := batches[:0]
+	for _, b := range batches {
+		if _, ok := segment.pending[b.entry.id]; ok {
+			unacked = append(unacked, b)
+		}
+	}
+	return unacked, nil
+}
+
+// Append a batch to the current segment before it is sent
+func (s *spool) write(messages []*MeterMessage) (*spoolEntry, error) {
+	id := s.uid()
+	line, err := json.Marshal(&spoolRecord{Batch: id, Messages: messages})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling spool record: %s", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current != nil && s.current.size+int64(len(line)) > s.segmentBytes {
+		s.seal(s.current)
+	}
+	if s.current == nil {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	segment := s.current
+	if _, err := segment.file.Write(line); err != nil {
+		return nil, fmt.Errorf("error writing spool segment: %s", err)
+	}
+	if err := segment.file.Sync(); err != nil {
+		return nil, fmt.Errorf("error syncing spool segment: %s", err)
+	}
+	segment.size += int64(len(line))
+	segment.pending[id] = struct{}{}
+	return &spoolEntry{segment: segment, id: id}, nil
+}
+
+// Acknowledge a batch ingested by the API, deleting its segment once nothing is pending
+func (s *spool) ack(entry *spoolEntry) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	segment := entry.segment
+	if segment.deleted {
+		return
+	}
+	delete(segment.pending, entry.id)
+	if len(segment.pending) == 0 && segment.sealed {
+		s.remove(segment)
+		return
+	}
+
+	line, _ := json.Marshal(&spoolRecord{Ack: entry.id})
+	line = append(line, '\n')
+	if err := s.appendTo(segment, line); err != nil {
+		s.logger.Logf("spool: error acknowledging batch %s: %s", entry.id, err)
+	}
+}
+
+// Close the current segment, deleting it when all of its batches were acknowledged
+func (s *spool) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.current != nil {
+		s.seal(s.current)
+	}
+}
+
+func (s *spool) appendTo(segment *spoolSegment, line []byte) error {
+	file := segment.file
+	if file == nil {
+		var err error
+		file, err = os.OpenFile(segment.path, os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+	}
+	if _, err := file.Write(line); err != nil {
+		return err
+	}
+	segment.size += int64(len(line))
+	return nil
+}
+
+// Start a new current segment
+func (s *spool) rotate() error {
+	now := s.now()
+	path := filepath.Join(s.dir, fmt.Sprintf("%020d%s", now.UnixNano(), spoolSegmentExt))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("error creating spool segment: %s", err)
+	}
+	s.current = &spoolSegment{
+		path:    path,
+		file:    file,
+		created: now,
+		pending: make(map[string]struct{}),
+	}
+	s.segments = append(s.segments, s.current)
+	s.enforceRetention()
+	return nil
+}
+
+// Stop appending to a segment
+func (s *spool) seal(segment *spoolSegment) {
+	if segment.file != nil {
+		segment.file.Close()
+		segment.file = nil
+	}
+	segment.sealed = true
+	if s.current == segment {
+		s.current = nil
+	}
+	if len(segment.pending) == 0 {
+		s.remove(segment)
+	}
+}
+
+// Delete the oldest sealed segments exceeding SpoolMaxAge or SpoolMaxBytes
+func (s *spool) enforceRetention() {
+	var total int64
+	for _, segment := range s.segments {
+		total += segment.size
+	}
+
+	now := s.now()
+	for _, segment := range append([]*spoolSegment(nil), s.segments...) {
+		if !segment.sealed {
+			continue
+		}
+		expired := s.maxAge > 0 && now.Sub(segment.created) > s.maxAge
+		oversized := s.maxBytes > 0 && total > s.maxBytes
+		if !expired && !oversized {
+			continue
+		}
+		s.logger.Logf("spool: retention limit reached, discarding segment %s with %d pending batches", segment.path, len(segment.pending))
+		total -= segment.size
+		s.remove(segment)
+	}
+}
+
+func (s *spool) remove(segment *spoolSegment) {
+	if err := os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
+		s.logger.Logf("spool: error deleting segment %s: %s", segment.path, err)
+	}
+	segment.deleted = true
+	for i, other := range s.segments {
+		if other == segment {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package metering
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot of the ingest pipeline counters
+type Stats struct {
+	// Enqueued counts the messages accepted by Meter.
+	Enqueued uint64
+	// Sent and Failed count the messages of the batches delivered or lost after all retries.
+	Sent   uint64
+	Failed uint64
+	// Retried counts the retried ingest API calls.
+	Retried uint64
+	// Dropped counts the messages dropped by the overflow policy.
+	Dropped           uint64
+	DuplicatesDropped uint64
+	InFlightBatches   int
+	QueueDepth        int
+	// ConcurrencyLimit is the current adaptive limit of concurrent ingest API calls.
+	ConcurrencyLimit int
+	// LastErrorTime is the time of the last failed ingest API call, zero if none failed.
+	LastErrorTime time.Time
+}
+
+func (m *Metering) Stats() Stats {
+	m.mutex.Lock()
+	inFlight := len(m.batches)
+	m.mutex.Unlock()
+
+	stats := Stats{
+		Enqueued:          atomic.LoadUint64(&m.enqueued),
+		Sent:              atomic.LoadUint64(&m.sent),
+		Failed:            atomic.LoadUint64(&m.failed),
+		Retried:           atomic.LoadUint64(&m.retried),
+		Dropped:           atomic.LoadUint64(&m.dropped),
+		DuplicatesDropped: atomic.LoadUint64(&m.duplicates),
+		InFlightBatches:   inFlight,
+		QueueDepth:        len(m.msgs),
+		ConcurrencyLimit:  m.ConcurrencyLimit(),
+	}
+	if nanos := atomic.LoadInt64(&m.lastErrorNanos); nanos > 0 {
+		stats.LastErrorTime = time.Unix(0, nanos)
+	}
+	return stats
+}
+
+// http.Handler serving the Stats in the Prometheus text exposition format
+func (m *Metering) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := m.Stats()
+		lastError := 0.0
+		if !stats.LastErrorTime.IsZero() {
+			lastError = float64(stats.LastErrorTime.UnixNano()) / float64(time.Second)
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetric(w, "amberflo_metering_enqueued_total", "counter", "Meter messages accepted by Meter.", float64(stats.Enqueued))
+		writeMetric(w, "amberflo_metering_sent_total", "counter", "Meter messages delivered to the ingest API.", float64(stats.Sent))
+		writeMetric(w, "amberflo_metering_failed_total", "counter", "Meter messages not delivered after all retries.", float64(stats.Failed))
+		writeMetric(w, "amberflo_metering_retries_total", "counter", "Retried ingest API calls.", float64(stats.Retried))
+		writeMetric(w, "amberflo_metering_dropped_total", "counter", "Meter messages dropped by the overflow policy.", float64(stats.Dropped))
+		writeMetric(w, "amberflo_metering_duplicates_dropped_total", "counter", "Meter messages dropped as duplicates.", float64(stats.DuplicatesDropped))
+		writeMetric(w, "amberflo_metering_in_flight_batches", "gauge", "Batches being sent to the ingest API.", float64(stats.InFlightBatches))
+		writeMetric(w, "amberflo_metering_queue_depth", "gauge", "Meter messages waiting in the queue.", float64(stats.QueueDepth))
+		writeMetric(w, "amberflo_metering_concurrency_limit", "gauge", "Current limit of concurrent ingest API calls.", float64(stats.ConcurrencyLimit))
+		writeMetric(w, "amberflo_metering_last_error_timestamp_seconds", "gauge", "Time of the last failed ingest API call.", lastError)
+	})
+}
+
+func writeMetric(w http.ResponseWriter, name string, metricType string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, metricType, name, value)
+}
@@ -0,0 +1,24 @@
+package metering
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer observes every HTTP call made to the Amberflo API, for example to
+// bridge them to a distributed tracing system.
+type Tracer interface {
+	// StartRequest is called before a request is sent with the context of the
+	// call, so the request can be traced as a child of the caller's span. It
+	// returns the context the request is sent with, for example carrying the
+	// span for a Middleware injecting the trace headers, and the hook notified
+	// when the request completes.
+	StartRequest(ctx context.Context, apiName string, method string, url string) (context.Context, RequestHook)
+}
+
+// RequestHook is notified of the outcome of a traced request.
+type RequestHook interface {
+	// EndRequest receives the response status, 0 when no response was received,
+	// the duration of the call and its error, if any.
+	EndRequest(status int, duration time.Duration, err error)
+}
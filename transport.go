@@ -0,0 +1,91 @@
+package metering
+
+import "net/http"
+
+// Middleware wraps the transport of the HTTP calls to the Amberflo API, for
+// example to add headers or sign requests.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Adapter to use an ordinary function as an http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware setting the given headers on every request
+func HeaderMiddleware(header http.Header) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			//a RoundTripper must not modify the request it is given
+			req = req.Clone(req.Context())
+			for key, values := range header {
+				req.Header[http.CanonicalHeaderKey(key)] = values
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Wrap the transport of client with the middlewares, the first one being the outermost
+func withMiddlewares(client http.Client, middlewares []Middleware) http.Client {
+	if len(middlewares) == 0 {
+		return client
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	client.Transport = transport
+	return client
+}
+
+// Send the requests with client instead of http.DefaultClient, for example to set a proxy or TLS configuration.
+// A nil client is ignored.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(u *BaseClient) {
+		if client != nil {
+			u.Client = *client
+		}
+	}
+}
+
+// Send the requests with transport
+func WithRoundTripper(transport http.RoundTripper) ClientOption {
+	return func(u *BaseClient) {
+		u.Client.Transport = transport
+	}
+}
+
+// Wrap the transport of the client with middlewares, the first one being the outermost
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(u *BaseClient) {
+		u.Middlewares = append(u.Middlewares, middlewares...)
+	}
+}
+
+// Send the meters with client instead of http.DefaultClient, a nil client is ignored
+func WithMeteringHTTPClient(client *http.Client) MeteringOption {
+	return func(m *Metering) {
+		if client != nil {
+			m.Client = *client
+		}
+	}
+}
+
+// Send the meters with transport
+func WithMeteringRoundTripper(transport http.RoundTripper) MeteringOption {
+	return func(m *Metering) {
+		m.Client.Transport = transport
+	}
+}
+
+// Wrap the transport of the metering client with middlewares, the first one being the outermost
+func WithMeteringMiddleware(middlewares ...Middleware) MeteringOption {
+	return func(m *Metering) {
+		m.Middlewares = append(m.Middlewares, middlewares...)
+	}
+}
@@ -1,6 +1,7 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -67,7 +68,11 @@ func NewUsageClient(apiKey string, opts ...ClientOption) *UsageClient {
 }
 
 func (u *UsageClient) GetUsageAsJson(payload *UsagePayload) (*string, error) {
-	url := fmt.Sprintf("%s/usage", Endpoint)
+	return u.GetUsageAsJsonContext(context.Background(), payload)
+}
+
+func (u *UsageClient) GetUsageAsJsonContext(ctx context.Context, payload *UsagePayload) (*string, error) {
+	url := fmt.Sprintf("%s/usage", u.BaseURL)
 
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -76,10 +81,10 @@ func (u *UsageClient) GetUsageAsJson(payload *UsagePayload) (*string, error) {
 
 	u.logf("Usage Payload %s", string(b))
 	apiName := "Usage"
-	body, err := u.AmberfloHttpClient.sendHttpRequest(apiName, url, "POST", b)
+	body, err := u.AmberfloHttpClient.sendReadOnlyRequestContext(ctx, apiName, url, "POST", b)
 	if err != nil {
 		u.logf("API error: %s", err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	v := string(body)
@@ -87,11 +92,15 @@ func (u *UsageClient) GetUsageAsJson(payload *UsagePayload) (*string, error) {
 }
 
 func (u *UsageClient) GetUsage(payload *UsagePayload) (*DetailedMeterAggregation, error) {
-	usageResult, err := u.GetUsageAsJson(payload)
+	return u.GetUsageContext(context.Background(), payload)
+}
+
+func (u *UsageClient) GetUsageContext(ctx context.Context, payload *UsagePayload) (*DetailedMeterAggregation, error) {
+	usageResult, err := u.GetUsageAsJsonContext(ctx, payload)
 
 	if err != nil {
 		u.logf("Usage API error: %s", err)
-		return nil, fmt.Errorf("error reading response body: %s", err)
+		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
 	var result DetailedMeterAggregation
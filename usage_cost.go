@@ -1,6 +1,7 @@
 package metering
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -59,7 +60,11 @@ func NewUsageCostClient(apiKey string, opts ...ClientOption) *UsageCostClient {
 }
 
 func (uc *UsageCostClient) GetUsageCostAsJson(payload *UsageCostsKey) (*string, error) {
-	url := fmt.Sprintf("%s/payments/cost/usage-cost", Endpoint)
+	return uc.GetUsageCostAsJsonContext(context.Background(), payload)
+}
+
+func (uc *UsageCostClient) GetUsageCostAsJsonContext(ctx context.Context, payload *UsageCostsKey) (*string, error) {
+	url := fmt.Sprintf("%s/payments/cost/usage-cost", uc.BaseURL)
 
 	b, err := json.Marshal(payload)
 	if err != nil {
@@ -68,10 +73,10 @@ func (uc *UsageCostClient) GetUsageCostAsJson(payload *UsageCostsKey) (*string,
 
 	uc.logf("Usage cost payload %s", string(b))
 	apiName := "Usage Cost"
-	body, err := uc.AmberfloHttpClient.sendHttpRequest(apiName, url, "POST", b)
+	body, err := uc.AmberfloHttpClient.sendReadOnlyRequestContext(ctx, apiName, url, "POST", b)
 	if err != nil {
 		uc.logf("API error: %s", err)
-		return nil, fmt.Errorf("API error: %s", err)
+		return nil, fmt.Errorf("API error: %w", err)
 	}
 
 	v := string(body)
@@ -79,14 +84,18 @@ func (uc *UsageCostClient) GetUsageCostAsJson(payload *UsageCostsKey) (*string,
 }
 
 func (uc *UsageCostClient) GetUsageCost(payload *UsageCostsKey) (*UsageCosts, error) {
+	return uc.GetUsageCostContext(context.Background(), payload)
+}
+
+func (uc *UsageCostClient) GetUsageCostContext(ctx context.Context, payload *UsageCostsKey) (*UsageCosts, error) {
 	if payload.ProductId == "" {
 		payload.ProductId = "1"
 	}
-	usageCostResult, err := uc.GetUsageCostAsJson(payload)
+	usageCostResult, err := uc.GetUsageCostAsJsonContext(ctx, payload)
 
 	if err != nil {
 		uc.logf("Usage Cost API error: %s", err)
-		return nil, fmt.Errorf("error reading response body: %s", err)
+		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
 	var result UsageCosts